@@ -20,6 +20,7 @@ import (
 	_ "github.com/ClearGrass/qpbee/cmd/commands/api"
 	_ "github.com/ClearGrass/qpbee/cmd/commands/bale"
 	_ "github.com/ClearGrass/qpbee/cmd/commands/beefix"
+	_ "github.com/ClearGrass/qpbee/cmd/commands/db"
 	_ "github.com/ClearGrass/qpbee/cmd/commands/dlv"
 	_ "github.com/ClearGrass/qpbee/cmd/commands/dockerize"
 	_ "github.com/ClearGrass/qpbee/cmd/commands/generate"
@@ -22,6 +22,7 @@ import (
 
 	"github.com/ClearGrass/qpbee/cmd/commands"
 	"github.com/ClearGrass/qpbee/cmd/commands/version"
+	"github.com/ClearGrass/qpbee/dialect"
 	"github.com/ClearGrass/qpbee/generate"
 	"github.com/ClearGrass/qpbee/logger"
 	"github.com/ClearGrass/qpbee/utils"
@@ -712,6 +713,11 @@ func createAPI(cmd *commands.Command, args []string) int {
 
 	os.MkdirAll(appPath, 0755)
 	fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", appPath, "\x1b[0m")
+	if utils.NeedsGoMod(appPath) {
+		fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(appPath, "go.mod"), "\x1b[0m")
+		utils.WriteToFile(path.Join(appPath, "go.mod"), utils.GoModContent(packPath))
+		beeLogger.Log.Hint("Run 'go mod tidy' inside the application directory to fetch its dependencies")
+	}
 
 	os.Mkdir(path.Join(appPath, "conf"), 0755)
 	fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(appPath, "conf"), "\x1b[0m")
@@ -762,12 +768,12 @@ func createAPI(cmd *commands.Command, args []string) int {
 	if generate.SQLConn != "" {
 		fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(appPath, "main.go"), "\x1b[0m")
 		mainGoContent := strings.Replace(apiMainconngo, "{{.Appname}}", packPath, -1)
-		mainGoContent = strings.Replace(mainGoContent, "{{.DriverName}}", string(generate.SQLDriver), -1)
-		if generate.SQLDriver == "mysql" {
-			mainGoContent = strings.Replace(mainGoContent, "{{.DriverPkg}}", `_ "github.com/go-sql-driver/mysql"`, -1)
-		} else if generate.SQLDriver == "postgres" {
-			mainGoContent = strings.Replace(mainGoContent, "{{.DriverPkg}}", `_ "github.com/lib/pq"`, -1)
+		d, err := dialect.Get(generate.SQLDriver.String())
+		if err != nil {
+			beeLogger.Log.Fatalf("%s", err)
 		}
+		mainGoContent = strings.Replace(mainGoContent, "{{.DriverName}}", d.Name(), -1)
+		mainGoContent = strings.Replace(mainGoContent, "{{.DriverPkg}}", `_ "`+d.DriverPackage()+`"`, -1)
 		utils.WriteToFile(path.Join(appPath, "main.go"),
 			strings.Replace(
 				mainGoContent,
@@ -0,0 +1,110 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package db
+
+import (
+	"os"
+
+	"github.com/ClearGrass/qpbee/cmd/commands"
+	"github.com/ClearGrass/qpbee/cmd/commands/version"
+	"github.com/ClearGrass/qpbee/config"
+	"github.com/ClearGrass/qpbee/dialect"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+	"github.com/ClearGrass/qpbee/utils"
+)
+
+var CmdDb = &commands.Command{
+	UsageLine: "db [command]",
+	Short:     "Loads data into the database",
+	Long: `The command 'db' manages the data of the database of the application.
+
+  ▶ {{"To load the fixtures of database/seeds:"|bold}}
+
+    $ bee db seed [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"]
+
+  ▶ {{"To load the fixtures of database/seeds/<env> too:"|bold}}
+
+    $ bee db seed -env=test
+
+  The fixtures are .yml, .yaml or .json files mapping tables to their rows, e.g.
+
+    users:
+      - id: 1
+        name: admin
+
+  Each row is inserted, or updated if a row with the same primary key exists,
+  so seeding twice changes nothing. Each file is loaded in a transaction, the
+  files and tables referenced by foreign keys first. With -env, the database
+  of the profile of that name, if any, is used by default.
+`,
+	PreRun: func(cmd *commands.Command, args []string) { version.ShowShortVersionBanner() },
+	Run:    RunDb,
+}
+
+var dbDriver utils.DocValue
+var dbConn utils.DocValue
+var dbEnv string
+
+func init() {
+	CmdDb.Flag.Var(&dbDriver, "driver", "Database driver. Either mysql, postgres or sqlite.")
+	CmdDb.Flag.Var(&dbConn, "conn", "Connection string used by the driver to connect to a database instance.")
+	CmdDb.Flag.StringVar(&dbEnv, "env", "", "Environment whose fixtures of database/seeds/<env> are loaded too.")
+	commands.AvailableCommands = append(commands.AvailableCommands, CmdDb)
+}
+
+// RunDb is the entry point of the db command
+func RunDb(cmd *commands.Command, args []string) int {
+	currpath, _ := os.Getwd()
+
+	if len(args) == 0 {
+		beeLogger.Log.Fatal("Command is missing")
+	}
+	if args[0] != "seed" {
+		beeLogger.Log.Fatalf("Unknown command '%s'. Available commands: seed", args[0])
+	}
+	cmd.Flag.Parse(args[1:])
+
+	database := config.Conf.Database
+	if p, ok := config.Conf.Profiles[dbEnv]; ok && dbEnv != "" {
+		if p.Database.Driver != "" {
+			database.Driver = p.Database.Driver
+		}
+		if p.Database.Conn != "" {
+			database.Conn = p.Database.Conn
+		}
+	}
+	if dbDriver == "" {
+		dbDriver = utils.DocValue(database.Driver)
+		if dbDriver == "" {
+			dbDriver = "mysql"
+		}
+	}
+	d, err := dialect.Get(string(dbDriver))
+	if err != nil {
+		beeLogger.Log.Fatalf("%s", err)
+	}
+	if dbConn == "" {
+		dbConn = utils.DocValue(database.Conn)
+		if dbConn == "" {
+			dbConn = utils.DocValue(d.DefaultConn())
+		}
+	}
+	beeLogger.Log.Infof("Using '%s' as 'driver'", d.Name())
+	beeLogger.Log.Infof("Using '%s' as 'conn'", utils.MaskPassword(string(dbConn)))
+
+	Seed(currpath, d, string(dbConn), dbEnv)
+	beeLogger.Log.Success("Seeding successful!")
+	return 0
+}
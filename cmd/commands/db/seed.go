@@ -0,0 +1,375 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ClearGrass/qpbee/dialect"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// seedFile is a fixture file of database/seeds
+type seedFile struct {
+	file   string // Relative to database/seeds.
+	rows   map[string][]map[string]interface{}
+	tables []string // Tables of the file, the referenced ones first.
+}
+
+// seedTable is what the seeding needs to know of a table
+type seedTable struct {
+	name    string
+	columns map[string]bool
+	pk      []string // Columns of the primary key, in order.
+	auto    string   // Auto-incremented column of the primary key, if any.
+	refs    []string // Other tables its foreign keys reference.
+}
+
+// seeder loads the fixture files into the database
+type seeder struct {
+	db     *sql.DB
+	d      dialect.Dialect
+	tables map[string]*seedTable
+}
+
+// Seed loads the fixture files of database/seeds, and of database/seeds/<env> if env
+// is set, each in a transaction. The files and the tables referenced by foreign keys
+// are loaded first. The rows are inserted, or updated when their primary key exists.
+func Seed(currpath string, d dialect.Dialect, connStr, env string) {
+	dir := path.Join(currpath, "database", "seeds")
+	files := listSeeds(dir, "")
+	if env != "" {
+		envFiles := listSeeds(dir, env)
+		if len(envFiles) == 0 {
+			beeLogger.Log.Warnf("No fixtures found in '%s'", path.Join(dir, env))
+		}
+		files = append(files, envFiles...)
+	}
+	if len(files) == 0 {
+		beeLogger.Log.Fatalf("Could not find any .yml, .yaml or .json fixture file in '%s'", dir)
+	}
+
+	db, err := sql.Open(d.Name(), connStr)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not connect to database using '%s': %s", connStr, err)
+	}
+	defer db.Close()
+
+	s := &seeder{db: db, d: d, tables: make(map[string]*seedTable)}
+	existing, err := d.Tables(db)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show tables: %s", err)
+	}
+	for _, t := range existing {
+		s.tables[t] = nil
+	}
+
+	seeds := make(map[string]*seedFile, len(files))
+	for _, file := range files {
+		f := readSeedFile(dir, file)
+		for table := range f.rows {
+			s.table(table, file)
+		}
+		seeds[file] = f
+	}
+
+	// The files holding the tables referenced by the other files first
+	holders := make(map[string][]string)
+	for _, file := range files {
+		for table := range seeds[file].rows {
+			holders[table] = append(holders[table], file)
+		}
+	}
+	files = dependencyOrder(files, func(file string) []string {
+		var deps []string
+		for table := range seeds[file].rows {
+			for _, ref := range s.tables[table].refs {
+				for _, holder := range holders[ref] {
+					if holder != file {
+						deps = append(deps, holder)
+					}
+				}
+			}
+		}
+		sort.Strings(deps)
+		return deps
+	})
+
+	for _, file := range files {
+		f := seeds[file]
+		for table := range f.rows {
+			f.tables = append(f.tables, table)
+		}
+		sort.Strings(f.tables)
+		f.tables = dependencyOrder(f.tables, func(table string) []string {
+			var deps []string
+			for _, ref := range s.tables[table].refs {
+				if _, ok := f.rows[ref]; ok {
+					deps = append(deps, ref)
+				}
+			}
+			return deps
+		})
+		s.load(f)
+	}
+}
+
+// listSeeds returns the fixture files of a directory of database/seeds, sorted by name
+func listSeeds(dir, sub string) []string {
+	infos, err := ioutil.ReadDir(path.Join(dir, sub))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		beeLogger.Log.Fatalf("Could not read fixture directory: %s", err)
+	}
+	var files []string
+	for _, info := range infos {
+		switch path.Ext(info.Name()) {
+		case ".yml", ".yaml", ".json":
+			if !info.IsDir() {
+				files = append(files, path.Join(sub, info.Name()))
+			}
+		}
+	}
+	return files
+}
+
+// readSeedFile parses a fixture file, mapping the tables to their rows
+func readSeedFile(dir, file string) *seedFile {
+	content, err := ioutil.ReadFile(path.Join(dir, file))
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not read fixture file: %s", err)
+	}
+	f := &seedFile{file: file}
+	if path.Ext(file) == ".json" {
+		// Numbers are kept as written, so that big integers are not rounded
+		dec := json.NewDecoder(bytes.NewReader(content))
+		dec.UseNumber()
+		err = dec.Decode(&f.rows)
+	} else {
+		err = yaml.Unmarshal(content, &f.rows)
+	}
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not parse fixture file '%s': %s", file, err)
+	}
+	return f
+}
+
+// table returns the table of a fixture file, introspected once
+func (s *seeder) table(name, file string) *seedTable {
+	t, ok := s.tables[name]
+	if !ok {
+		beeLogger.Log.Hint("Run 'bee migrate' to create the tables before seeding them")
+		beeLogger.Log.Fatalf("Could not find table '%s' of fixture file '%s'", name, file)
+	}
+	if t != nil {
+		return t
+	}
+
+	columns, err := s.d.Columns(s.db, name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show columns of '%s': %s", name, err)
+	}
+	constraints, err := s.d.Constraints(s.db, name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query constraints of '%s': %s", name, err)
+	}
+	t = &seedTable{name: name, columns: make(map[string]bool, len(columns))}
+	for _, c := range columns {
+		t.columns[c.Name] = true
+		if c.PrimaryKey && c.AutoIncrement {
+			t.auto = c.Name
+		}
+	}
+	var pk []dialect.Constraint
+	refs := make(map[string]bool)
+	for _, c := range constraints {
+		switch c.Type {
+		case dialect.PrimaryKey:
+			pk = append(pk, c)
+		case dialect.ForeignKey:
+			if c.RefTable != name && !refs[c.RefTable] {
+				refs[c.RefTable] = true
+				t.refs = append(t.refs, c.RefTable)
+			}
+		}
+	}
+	if len(pk) == 0 {
+		beeLogger.Log.Fatalf("Could not seed table '%s', it has no primary key to match its rows by", name)
+	}
+	for i := 1; i < len(pk); i++ {
+		for j := i; j > 0 && pk[j].Position < pk[j-1].Position; j-- {
+			pk[j], pk[j-1] = pk[j-1], pk[j]
+		}
+	}
+	for _, c := range pk {
+		t.pk = append(t.pk, c.Column)
+	}
+	sort.Strings(t.refs)
+	s.tables[name] = t
+	return t
+}
+
+// load loads a fixture file in a transaction
+func (s *seeder) load(f *seedFile) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not start transaction: %s", err)
+	}
+	inserted, updated := 0, 0
+	for _, name := range f.tables {
+		for i, row := range f.rows[name] {
+			insert, err := s.upsert(tx, s.tables[name], row)
+			if err != nil {
+				tx.Rollback()
+				beeLogger.Log.Fatalf("Could not seed row %d of '%s' of '%s': %s", i+1, name, f.file, err)
+			}
+			if insert {
+				inserted++
+			} else {
+				updated++
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		beeLogger.Log.Fatalf("Could not commit fixture file '%s': %s", f.file, err)
+	}
+
+	// The rows have explicit primary keys, which the sequences must not give again
+	for _, name := range f.tables {
+		t := s.tables[name]
+		if t.auto == "" {
+			continue
+		}
+		if statement := s.d.SyncSequence(t.name, t.auto); statement != "" {
+			if _, err := s.db.Exec(statement); err != nil {
+				beeLogger.Log.Fatalf("Could not update the sequence of '%s': %s", t.name, err)
+			}
+		}
+	}
+	beeLogger.Log.Infof("|> %s: %d row(s) inserted, %d updated", f.file, inserted, updated)
+}
+
+// upsert inserts a row, or updates the row with the same primary key. It reports
+// whether the row was inserted.
+func (s *seeder) upsert(tx *sql.Tx, t *seedTable, row map[string]interface{}) (bool, error) {
+	columns := make([]string, 0, len(row))
+	for c, v := range row {
+		if !t.columns[c] {
+			return false, fmt.Errorf("table has no column '%s'", c)
+		}
+		switch v.(type) {
+		case map[interface{}]interface{}, map[string]interface{}, []interface{}:
+			return false, fmt.Errorf("value of column '%s' is not a scalar", c)
+		}
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+
+	isPK := make(map[string]bool, len(t.pk))
+	var where []string
+	var keys []interface{}
+	for _, c := range t.pk {
+		v, ok := row[c]
+		if !ok {
+			return false, fmt.Errorf("primary key column '%s' is missing", c)
+		}
+		isPK[c] = true
+		keys = append(keys, v)
+		where = append(where, s.d.Quote(c)+" = "+s.d.Placeholder(len(keys)))
+	}
+	table := s.d.Quote(t.name)
+
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+strings.Join(where, " AND "), keys...).Scan(&n); err != nil {
+		return false, err
+	}
+	if n == 0 {
+		quoted := make([]string, len(columns))
+		placeholders := make([]string, len(columns))
+		args := make([]interface{}, len(columns))
+		for i, c := range columns {
+			quoted[i] = s.d.Quote(c)
+			placeholders[i] = s.d.Placeholder(i + 1)
+			args[i] = row[c]
+		}
+		_, err := tx.Exec("INSERT INTO "+table+" ("+strings.Join(quoted, ", ")+") VALUES ("+strings.Join(placeholders, ", ")+")", args...)
+		return true, err
+	}
+
+	var (
+		set  []string
+		args []interface{}
+	)
+	for _, c := range columns {
+		if !isPK[c] {
+			args = append(args, row[c])
+			set = append(set, s.d.Quote(c)+" = "+s.d.Placeholder(len(args)))
+		}
+	}
+	if len(set) == 0 {
+		return false, nil
+	}
+	where = where[:0]
+	for _, c := range t.pk {
+		args = append(args, row[c])
+		where = append(where, s.d.Quote(c)+" = "+s.d.Placeholder(len(args)))
+	}
+	_, err := tx.Exec("UPDATE "+table+" SET "+strings.Join(set, ", ")+" WHERE "+strings.Join(where, " AND "), args...)
+	return false, err
+}
+
+// dependencyOrder returns the nodes, each after the ones it depends on, keeping their
+// order otherwise. The dependencies of a cycle are loaded in their order.
+func dependencyOrder(nodes []string, deps func(string) []string) []string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	var (
+		ordered []string
+		state   = make(map[string]int, len(nodes))
+		visit   func(n string)
+	)
+	visit = func(n string) {
+		switch state[n] {
+		case visiting:
+			beeLogger.Log.Warnf("Cyclic foreign keys through '%s', loading it in its order", n)
+			return
+		case done:
+			return
+		}
+		state[n] = visiting
+		for _, dep := range deps(n) {
+			visit(dep)
+		}
+		state[n] = done
+		ordered = append(ordered, n)
+	}
+	for _, n := range nodes {
+		visit(n)
+	}
+	return ordered
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/ClearGrass/qpbee/cmd/commands"
 	"github.com/ClearGrass/qpbee/cmd/commands/api"
 	"github.com/ClearGrass/qpbee/cmd/commands/version"
+	"github.com/ClearGrass/qpbee/dialect"
 	"github.com/ClearGrass/qpbee/generate"
 	beeLogger "github.com/ClearGrass/qpbee/logger"
 	"github.com/ClearGrass/qpbee/utils"
@@ -85,13 +86,13 @@ func createhprose(cmd *commands.Command, args []string) int {
 
 		fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "main.go"), "\x1b[0m")
 		maingoContent := strings.Replace(generate.HproseMainconngo, "{{.Appname}}", packpath, -1)
-		maingoContent = strings.Replace(maingoContent, "{{.DriverName}}", string(generate.SQLDriver), -1)
-		maingoContent = strings.Replace(maingoContent, "{{HproseFunctionList}}", strings.Join(generate.HproseAddFunctions, ""), -1)
-		if generate.SQLDriver == "mysql" {
-			maingoContent = strings.Replace(maingoContent, "{{.DriverPkg}}", `_ "github.com/go-sql-driver/mysql"`, -1)
-		} else if generate.SQLDriver == "postgres" {
-			maingoContent = strings.Replace(maingoContent, "{{.DriverPkg}}", `_ "github.com/lib/pq"`, -1)
+		d, err := dialect.Get(generate.SQLDriver.String())
+		if err != nil {
+			beeLogger.Log.Fatalf("%s", err)
 		}
+		maingoContent = strings.Replace(maingoContent, "{{.DriverName}}", d.Name(), -1)
+		maingoContent = strings.Replace(maingoContent, "{{HproseFunctionList}}", strings.Join(generate.HproseAddFunctions, ""), -1)
+		maingoContent = strings.Replace(maingoContent, "{{.DriverPkg}}", `_ "`+d.DriverPackage()+`"`, -1)
 		utils.WriteToFile(path.Join(apppath, "main.go"),
 			strings.Replace(
 				maingoContent,
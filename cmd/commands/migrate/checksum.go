@@ -0,0 +1,87 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path"
+
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+)
+
+// fileChecksum returns the SHA-256 of the file of a migration,
+// the .up.sql one of an SQL migration
+func fileChecksum(dir, file string) string {
+	content, err := ioutil.ReadFile(path.Join(dir, file))
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not read migration file: %s", err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyChecksums checks that the files of the applied migrations did not change since
+// they were applied, and records the checksum of those applied before bee recorded them.
+// The changed migrations are reported and stop the run, unless it is forced, which
+// records their new checksum.
+func (m *migrator) verifyChecksums(records []migrationRecord, migrations []migrationFile, force bool) {
+	files := make(map[string]migrationFile, len(migrations))
+	for _, mf := range migrations {
+		files[mf.name] = mf
+	}
+
+	var missing, changed []migrationFile
+	for _, r := range records {
+		mf, ok := files[r.name]
+		if !ok || r.status != "update" {
+			continue
+		}
+		switch sum := fileChecksum(m.dir, mf.file); {
+		case r.checksum == "":
+			missing = append(missing, mf)
+		case r.checksum != sum:
+			beeLogger.Log.Errorf("Migration '%s' changed since it was applied: %s", r.name, mf.file)
+			changed = append(changed, mf)
+		}
+	}
+
+	if len(changed) > 0 {
+		if !force {
+			beeLogger.Log.Hint("Revert the changes and add a new migration instead, or run with -force to migrate anyway")
+			beeLogger.Log.Fatalf("%d applied migration(s) changed", len(changed))
+		}
+		beeLogger.Log.Warnf("Migrating anyway, recording the new checksum of %d changed migration(s)", len(changed))
+	}
+	if len(missing) > 0 {
+		beeLogger.Log.Infof("Recording the checksum of %d applied migration(s)", len(missing))
+	}
+	if m.dryRun {
+		return
+	}
+	for _, mf := range append(missing, changed...) {
+		m.recordChecksum(mf)
+	}
+}
+
+// recordChecksum records the checksum of the file of an applied migration
+func (m *migrator) recordChecksum(mf migrationFile) {
+	query := "UPDATE migrations SET checksum = " + m.d.Placeholder(1) +
+		" WHERE name = " + m.d.Placeholder(2) + " AND status = 'update'"
+	if _, err := m.db.Exec(query, fileChecksum(m.dir, mf.file), mf.name); err != nil {
+		beeLogger.Log.Fatalf("Could not record the checksum of migration '%s': %s", mf.name, err)
+	}
+}
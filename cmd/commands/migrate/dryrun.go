@@ -0,0 +1,153 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ClearGrass/qpbee/dialect"
+
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+)
+
+const (
+	// dryRunSource is the file of the driver recording the statements of the migration binary
+	dryRunSource = "m_dryrun.go"
+	// dryRunDriver is the name the binary registers that driver under
+	dryRunDriver = "beedryrun"
+	// dryRunFileEnv is the environment variable of the file the binary writes the statements to
+	dryRunFileEnv = "BEE_MIGRATE_DRY_RUN_FILE"
+)
+
+// ormDriverTypes maps the drivers to their type in the orm of beego,
+// which the driver of the dry run stands for
+var ormDriverTypes = map[string]string{
+	"mysql":    "orm.DRMySQL",
+	"postgres": "orm.DRPostgres",
+	"sqlite3":  "orm.DRSqlite",
+}
+
+// dryRunSourceContent returns the source of the driver recording the statements
+// of the migration binary, written to the file given by the environment
+func dryRunSourceContent(d dialect.Dialect) []byte {
+	content := strings.Replace(MigrationDryRunTPL, "{{DriverName}}", dryRunDriver, -1)
+	content = strings.Replace(content, "{{DriverType}}", ormDriverTypes[d.Name()], -1)
+	content = strings.Replace(content, "{{DryRunFileEnv}}", dryRunFileEnv, -1)
+	return []byte(content)
+}
+
+// writeDryRun writes the statements of a migration, the way the migration binary does
+func writeDryRun(w io.Writer, name, goal string, statements []string) {
+	fmt.Fprintf(w, "-- %s (%s)\n", name, goal)
+	for _, s := range statements {
+		fmt.Fprintf(w, "%s;\n", strings.TrimRight(strings.TrimSpace(s), ";"))
+	}
+	fmt.Fprintln(w)
+}
+
+// printDryRun prints the statements of the dry run, and writes them to the output file if any
+func (m *migrator) printDryRun(output string) {
+	fmt.Print(m.dry.String())
+	if output == "" {
+		return
+	}
+	if err := ioutil.WriteFile(output, m.dry.Bytes(), 0666); err != nil {
+		beeLogger.Log.Fatalf("Could not write the statements of the dry run: %s", err)
+	}
+	beeLogger.Log.Infof("Statements written to '%s'", output)
+}
+
+const (
+	// MigrationDryRunTPL is the driver the migration binary executes the statements
+	// with in a dry run. It records them, grouped by the migration the following
+	// insert or update of the migrations table is about, and executes nothing.
+	MigrationDryRunTPL = `package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+)
+
+func init() {
+	sql.Register("{{DriverName}}", dryRunDriver{})
+	orm.RegisterDriver("{{DriverName}}", {{DriverType}})
+}
+
+// dryRunStatements are the statements of the running migration
+var dryRunStatements []string
+
+type dryRunDriver struct{}
+
+func (dryRunDriver) Open(string) (driver.Conn, error) { return dryRunConn{}, nil }
+
+type dryRunConn struct{}
+
+func (dryRunConn) Prepare(query string) (driver.Stmt, error) { return dryRunStmt(query), nil }
+func (dryRunConn) Close() error                              { return nil }
+func (dryRunConn) Begin() (driver.Tx, error)                 { return dryRunConn{}, nil }
+func (dryRunConn) Commit() error                             { return nil }
+func (dryRunConn) Rollback() error                           { return nil }
+
+type dryRunStmt string
+
+func (dryRunStmt) Close() error  { return nil }
+func (dryRunStmt) NumInput() int { return -1 }
+
+func (s dryRunStmt) Exec(args []driver.Value) (driver.Result, error) {
+	query := strings.ToLower(strings.TrimSpace(string(s)))
+	switch {
+	case strings.HasPrefix(query, "insert into migrations"):
+		dryRunWrite(args[0], "upgrade")
+	case strings.HasPrefix(query, "update migrations"):
+		dryRunWrite(args[len(args)-1], "down")
+	default:
+		dryRunStatements = append(dryRunStatements, string(s))
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (dryRunStmt) Query([]driver.Value) (driver.Rows, error) { return dryRunRows{}, nil }
+
+type dryRunRows struct{}
+
+func (dryRunRows) Columns() []string         { return nil }
+func (dryRunRows) Close() error              { return nil }
+func (dryRunRows) Next([]driver.Value) error { return io.EOF }
+
+func dryRunWrite(name driver.Value, goal string) {
+	f, err := os.OpenFile(os.Getenv("{{DryRunFileEnv}}"), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "-- %s (%s)\n", name, goal)
+	for _, s := range dryRunStatements {
+		fmt.Fprintf(f, "%s;\n", strings.TrimRight(strings.TrimSpace(s), ";"))
+	}
+	fmt.Fprintln(f)
+	dryRunStatements = nil
+}
+`
+)
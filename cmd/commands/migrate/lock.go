@@ -0,0 +1,67 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package migrate
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ClearGrass/qpbee/dialect"
+
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+)
+
+// lockTimeout is how long a run waits for another one to release the lock of the migrations
+const lockTimeout = 10 * time.Minute
+
+// lockMigrations takes the lock of the migrations, waiting for another run holding
+// it to finish, and returns the connection holding it
+func lockMigrations(d dialect.Dialect, connStr string) *sql.DB {
+	db, err := sql.Open(d.Name(), connStr)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not connect to database using '%s': %s", connStr, err)
+	}
+	// The lock belongs to the connection
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+
+	deadline := time.Now().Add(lockTimeout)
+	waiting := false
+	for {
+		holder, err := d.TryLock(db)
+		if err != nil {
+			beeLogger.Log.Fatalf("Could not lock the migrations: %s", err)
+		}
+		if holder == "" {
+			return db
+		}
+		if time.Now().After(deadline) {
+			beeLogger.Log.Fatalf("Could not lock the migrations, held by %s for more than %s", holder, lockTimeout)
+		}
+		if !waiting {
+			beeLogger.Log.Infof("Waiting for another run of the migrations to finish, the lock is held by %s", holder)
+			waiting = true
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// unlockMigrations releases the lock of the migrations and closes its connection
+func unlockMigrations(d dialect.Dialect, db *sql.DB) {
+	if err := d.Unlock(db); err != nil {
+		beeLogger.Log.Warnf("Could not unlock the migrations: %s", err)
+	}
+	db.Close()
+}
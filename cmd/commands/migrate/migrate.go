@@ -14,18 +14,18 @@
 package migrate
 
 import (
+	"bytes"
 	"database/sql"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
-	"runtime"
-	"strconv"
 	"strings"
-	"time"
 
 	"github.com/ClearGrass/qpbee/cmd/commands"
 	"github.com/ClearGrass/qpbee/cmd/commands/version"
 	"github.com/ClearGrass/qpbee/config"
+	"github.com/ClearGrass/qpbee/dialect"
 	"github.com/ClearGrass/qpbee/utils"
 
 	beeLogger "github.com/ClearGrass/qpbee/logger"
@@ -40,10 +40,22 @@ var CmdMigrate = &commands.Command{
 
     $ bee migrate [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"]
 
+  ▶ {{"To run them against a SQLite database file, database/dev.db by default:"|bold}}
+
+    $ bee migrate -driver=sqlite [-conn="database/dev.db"]
+
+  ▶ {{"To run the migrations up to a given one, included:"|bold}}
+
+    $ bee migrate up -to=<name> [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"]
+
   ▶ {{"To rollback the last migration:"|bold}}
 
     $ bee migrate rollback [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"]
 
+  ▶ {{"To rollback the last N migrations:"|bold}}
+
+    $ bee migrate down -steps=N [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"]
+
   ▶ {{"To do a reset, which will rollback all the migrations:"|bold}}
 
     $ bee migrate reset [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"]
@@ -51,6 +63,25 @@ var CmdMigrate = &commands.Command{
   ▶ {{"To update your schema:"|bold}}
 
     $ bee migrate refresh [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"]
+
+  ▶ {{"To show which migrations are applied, rolled back or pending:"|bold}}
+
+    $ bee migrate status [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"]
+
+  ▶ {{"To print the SQL statements of any of the above instead of running them:"|bold}}
+
+    $ bee migrate [command] -dry-run [-output=migrations.sql]
+
+  The migrations are the Go files and the pairs of <timestamp>_<name>.up.sql and
+  <timestamp>_<name>.down.sql files of database/migrations, run in the order of
+  their timestamps. The SQL ones run without building anything. The Go ones are
+  built into a binary, cached in the bee/migrate directory of the cache
+  directory of the user, e.g. ~/.cache/bee/migrate, until their sources or
+  the packages they import change.
+
+  A run holds a lock of the database, so concurrent runs wait for each other. The
+  checksum of each migration file is recorded when applied, and a run stops when
+  applied files changed since, unless -force is given.
 `,
 	PreRun: func(cmd *commands.Command, args []string) { version.ShowShortVersionBanner() },
 	Run:    RunMigration,
@@ -58,10 +89,20 @@ var CmdMigrate = &commands.Command{
 
 var mDriver utils.DocValue
 var mConn utils.DocValue
+var mTo string
+var mSteps int
+var mDryRun bool
+var mOutput string
+var mForce bool
 
 func init() {
 	CmdMigrate.Flag.Var(&mDriver, "driver", "Database driver. Either mysql, postgres or sqlite.")
 	CmdMigrate.Flag.Var(&mConn, "conn", "Connection string used by the driver to connect to a database instance.")
+	CmdMigrate.Flag.StringVar(&mTo, "to", "", "Name of the last migration to run with 'up', all of them if not set.")
+	CmdMigrate.Flag.IntVar(&mSteps, "steps", 1, "Number of migrations to rollback with 'down'.")
+	CmdMigrate.Flag.BoolVar(&mDryRun, "dry-run", false, "Print the SQL statements of the migrations instead of running them.")
+	CmdMigrate.Flag.StringVar(&mOutput, "output", "", "File to write the SQL statements of a dry run to.")
+	CmdMigrate.Flag.BoolVar(&mForce, "force", false, "Migrate even if applied migrations changed since they were applied.")
 	commands.AvailableCommands = append(commands.AvailableCommands, CmdMigrate)
 }
 
@@ -69,31 +110,31 @@ func init() {
 func RunMigration(cmd *commands.Command, args []string) int {
 	currpath, _ := os.Getwd()
 
-	gps := utils.GetGOPATHs()
-	if len(gps) == 0 {
-		beeLogger.Log.Fatal("GOPATH environment variable is not set or empty")
-	}
-
-	gopath := gps[0]
-
-	beeLogger.Log.Debugf("GOPATH: %s", utils.FILE(), utils.LINE(), gopath)
-
 	// Getting command line arguments
 	if len(args) != 0 {
 		cmd.Flag.Parse(args[1:])
 	}
+	if mOutput != "" && !mDryRun {
+		beeLogger.Log.Fatal("The -output flag requires -dry-run")
+	}
 	if mDriver == "" {
 		mDriver = utils.DocValue(config.Conf.Database.Driver)
 		if mDriver == "" {
 			mDriver = "mysql"
 		}
 	}
+	d := getDialect(string(mDriver))
+	mDriver = utils.DocValue(d.Name())
 	if mConn == "" {
 		mConn = utils.DocValue(config.Conf.Database.Conn)
 		if mConn == "" {
-			mConn = "root:@tcp(127.0.0.1:3306)/test"
+			mConn = utils.DocValue(d.DefaultConn())
 		}
 	}
+	if d.Name() == "sqlite3" && !path.IsAbs(string(mConn)) && !strings.HasPrefix(string(mConn), "file:") && string(mConn) != ":memory:" {
+		// The migration binary runs in the migrations directory
+		mConn = utils.DocValue(path.Join(currpath, string(mConn)))
+	}
 	beeLogger.Log.Infof("Using '%s' as 'driver'", mDriver)
 	beeLogger.Log.Infof("Using '%s' as 'conn'", mConn)
 	driverStr, connStr := string(mDriver), string(mConn)
@@ -104,6 +145,23 @@ func RunMigration(cmd *commands.Command, args []string) int {
 	} else {
 		mcmd := args[0]
 		switch mcmd {
+		case "up":
+			if mTo == "" {
+				beeLogger.Log.Info("Running all outstanding migrations")
+				MigrateUpdate(currpath, driverStr, connStr)
+			} else {
+				beeLogger.Log.Infof("Running the outstanding migrations up to '%s'", mTo)
+				MigrateUpTo(currpath, driverStr, connStr, mTo)
+			}
+		case "down":
+			if mSteps < 1 {
+				beeLogger.Log.Fatal("The number of steps must be at least 1")
+			}
+			beeLogger.Log.Infof("Rolling back the last %d migration(s)", mSteps)
+			MigrateDown(currpath, driverStr, connStr, mSteps)
+		case "status":
+			MigrateStatus(currpath, driverStr, connStr)
+			return 0
 		case "rollback":
 			beeLogger.Log.Info("Rolling back the last migration operation")
 			MigrateRollback(currpath, driverStr, connStr)
@@ -117,207 +175,287 @@ func RunMigration(cmd *commands.Command, args []string) int {
 			beeLogger.Log.Fatal("Command is missing")
 		}
 	}
+	if mDryRun {
+		beeLogger.Log.Success("Dry run done, nothing was migrated")
+		return 0
+	}
 	beeLogger.Log.Success("Migration successful!")
 	return 0
 }
 
-// migrate generates source code, build it, and invoke the binary who does the actual migration
-func migrate(goal, currpath, driver, connStr string) {
+// migrate runs the migrations of the database/migrations directory towards the goal.
+// The SQL migrations are run by bee itself. The Go ones are built into a binary, along with
+// the generated source, which does the actual migration, so that a project with only SQL
+// migrations needs no Go toolchain. With a target, "upgrade" stops at the target migration.
+// "down" rolls back the given number of migrations. A dry run prints the SQL statements
+// of the migrations instead of running them. A run holds the lock of the migrations, and
+// stops if applied migrations changed, unless forced.
+func migrate(goal, currpath, driver, connStr, target string, steps int) {
 	dir := path.Join(currpath, "database", "migrations")
-	postfix := ""
-	if runtime.GOOS == "windows" {
-		postfix = ".exe"
-	}
-	binary := "m" + postfix
-	source := binary + ".go"
 
 	// Connect to database
-	db, err := sql.Open(driver, connStr)
+	d := getDialect(driver)
+	db, err := sql.Open(d.Name(), connStr)
 	if err != nil {
 		beeLogger.Log.Fatalf("Could not connect to database using '%s': %s", connStr, err)
 	}
 	defer db.Close()
 
-	checkForSchemaUpdateTable(db, driver)
-	latestName, latestTime := getLatestMigration(db, goal)
-	writeMigrationSourceFile(dir, source, driver, connStr, latestTime, latestName, goal)
-	buildMigrationBinary(dir, binary)
-	runMigrationBinary(dir, binary)
-	removeTempFile(dir, source)
-	removeTempFile(dir, binary)
+	var records []migrationRecord
+	if !mDryRun {
+		lock := lockMigrations(d, connStr)
+		defer unlockMigrations(d, lock)
+		checkForSchemaUpdateTable(db, d)
+		records = getMigrationRecords(db, d)
+	} else if hasMigrationsTable(db, d) {
+		// A dry run changes nothing, not even the migrations table
+		records = getMigrationRecords(db, d)
+	}
+	migrations, others := listMigrations(dir)
+	m := &migrator{dir: dir, d: d, db: db, connStr: connStr, others: others, dryRun: mDryRun}
+	m.verifyChecksums(records, migrations, mForce)
+
+	switch goal {
+	case "upgrade":
+		m.run(goal, getPendingMigrations(records, migrations, dir, target))
+	case "down":
+		names := getAppliedMigrations(records, steps)
+		if len(names) == 0 {
+			beeLogger.Log.Fatal("There is nothing to rollback")
+		}
+		m.run(goal, findMigrations(migrations, dir, names))
+	case "reset", "refresh":
+		m.run("down", findMigrations(migrations, dir, getAppliedMigrations(records, -1)))
+		if goal == "refresh" {
+			// All of them are rolled back by now
+			m.run("upgrade", getPendingMigrations(nil, migrations, dir, ""))
+		}
+	}
+	if m.dryRun {
+		m.printDryRun(mOutput)
+	}
 }
 
-// checkForSchemaUpdateTable checks the existence of migrations table.
-// It checks for the proper table structures and creates the table using MYSQL_MIGRATION_DDL if it does not exist.
-func checkForSchemaUpdateTable(db *sql.DB, driver string) {
-	showTableSQL := showMigrationsTableSQL(driver)
-	if rows, err := db.Query(showTableSQL); err != nil {
-		beeLogger.Log.Fatalf("Could not show migrations table: %s", err)
-	} else if !rows.Next() {
-		// No migrations table, create new ones
-		createTableSQL := createMigrationsTableSQL(driver)
+// getPendingMigrations returns the migrations not applied yet, up to the target one if any
+func getPendingMigrations(records []migrationRecord, migrations []migrationFile, dir, target string) []migrationFile {
+	if target != "" {
+		i := findMigration(migrations, target)
+		if i < 0 {
+			beeLogger.Log.Fatalf("Could not find migration '%s' in %s", target, dir)
+		}
+		migrations = migrations[:i+1]
+	}
 
-		beeLogger.Log.Infof("Creating 'migrations' table...")
+	applied := make(map[string]bool)
+	for _, r := range records {
+		applied[r.name] = r.status == "update"
+	}
+	var pending []migrationFile
+	for _, m := range migrations {
+		if !applied[m.name] {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
 
-		if _, err := db.Query(createTableSQL); err != nil {
-			beeLogger.Log.Fatalf("Could not create migrations table: %s", err)
+// findMigrations returns the migrations of the given names, in their order
+func findMigrations(migrations []migrationFile, dir string, names []string) []migrationFile {
+	found := make([]migrationFile, 0, len(names))
+	for _, name := range names {
+		i := findMigration(migrations, name)
+		if i < 0 {
+			beeLogger.Log.Fatalf("Could not find migration '%s' in %s", name, dir)
 		}
+		found = append(found, migrations[i])
 	}
+	return found
+}
 
-	// Checking that migrations table schema are expected
-	selectTableSQL := selectMigrationsTableSQL(driver)
-	if rows, err := db.Query(selectTableSQL); err != nil {
-		beeLogger.Log.Fatalf("Could not show columns of migrations table: %s", err)
-	} else {
-		for rows.Next() {
-			var fieldBytes, typeBytes, nullBytes, keyBytes, defaultBytes, extraBytes []byte
-			if err := rows.Scan(&fieldBytes, &typeBytes, &nullBytes, &keyBytes, &defaultBytes, &extraBytes); err != nil {
-				beeLogger.Log.Fatalf("Could not read column information: %s", err)
-			}
-			fieldStr, typeStr, nullStr, keyStr, defaultStr, extraStr :=
-				string(fieldBytes), string(typeBytes), string(nullBytes), string(keyBytes), string(defaultBytes), string(extraBytes)
-			if fieldStr == "id_migration" {
-				if keyStr != "PRI" || extraStr != "auto_increment" {
-					beeLogger.Log.Hint("Expecting KEY: PRI, EXTRA: auto_increment")
-					beeLogger.Log.Fatalf("Column migration.id_migration type mismatch: KEY: %s, EXTRA: %s", keyStr, extraStr)
-				}
-			} else if fieldStr == "name" {
-				if !strings.HasPrefix(typeStr, "varchar") || nullStr != "YES" {
-					beeLogger.Log.Hint("Expecting TYPE: varchar, NULL: YES")
-					beeLogger.Log.Fatalf("Column migration.name type mismatch: TYPE: %s, NULL: %s", typeStr, nullStr)
-				}
-			} else if fieldStr == "created_at" {
-				if typeStr != "timestamp" || defaultStr != "CURRENT_TIMESTAMP" {
-					beeLogger.Log.Hint("Expecting TYPE: timestamp, DEFAULT: CURRENT_TIMESTAMP")
-					beeLogger.Log.Fatalf("Column migration.timestamp type mismatch: TYPE: %s, DEFAULT: %s", typeStr, defaultStr)
-				}
+// migrator runs the migrations of a directory against a database
+type migrator struct {
+	dir     string
+	d       dialect.Dialect
+	db      *sql.DB
+	connStr string
+	others  []string // Go files of the directory other than the migrations.
+	dryRun  bool
+	dry     bytes.Buffer // Statements of the dry run.
+}
+
+// run applies ("upgrade") or rolls back ("down") the migrations in the given order.
+// The consecutive Go migrations are run together by a single binary.
+func (m *migrator) run(goal string, migrations []migrationFile) {
+	if len(migrations) == 0 {
+		beeLogger.Log.Info("There is no migration to run")
+		return
+	}
+	var batch []migrationFile
+	for _, mf := range migrations {
+		if !mf.sql {
+			batch = append(batch, mf)
+			continue
+		}
+		m.runGo(goal, batch)
+		batch = nil
+		if m.dryRun {
+			file := mf.file
+			if goal == "down" {
+				file = downFile(mf)
 			}
+			writeDryRun(&m.dry, mf.name, goal, readStatements(m.d, m.dir, file))
+			continue
 		}
+		runSQLMigration(m.db, m.d, m.dir, mf, goal)
 	}
+	m.runGo(goal, batch)
 }
 
-func showMigrationsTableSQL(driver string) string {
-	switch driver {
-	case "mysql":
-		return "SHOW TABLES LIKE 'migrations'"
-	case "postgres":
-		return "SELECT * FROM pg_catalog.pg_tables WHERE tablename = 'migrations';"
-	default:
-		return "SHOW TABLES LIKE 'migrations'"
+// runGo runs the given Go migrations with a binary built with only them, so that
+// it runs all of them. The connection string is passed through the environment.
+func (m *migrator) runGo(goal string, migrations []migrationFile) {
+	if len(migrations) == 0 {
+		return
+	}
+
+	driver := m.d.Name()
+	sources := make(map[string][]byte)
+	if m.dryRun {
+		// The binary records the statements with a driver of its own
+		driver = dryRunDriver
+		sources[dryRunSource] = dryRunSourceContent(m.d)
+	}
+	sources[mainSource] = migrationMainSourceContent(m.d, driver)
+	args := []string{goal}
+	for _, file := range m.others {
+		sources[file] = readSource(m.dir, file)
 	}
+	for _, mf := range migrations {
+		sources[mf.file] = readSource(m.dir, mf.file)
+		args = append(args, mf.name)
+	}
+
+	binary := buildMigrationBinary(m.dir, sources)
+	env := []string{connEnv + "=" + m.connStr}
+	if !m.dryRun {
+		runMigrationBinary(m.dir, binary, args, env)
+		if goal == "upgrade" {
+			for _, mf := range migrations {
+				m.recordChecksum(mf)
+			}
+		}
+		return
+	}
+
+	out, err := ioutil.TempFile("", "bee-dry-run")
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not create file: %s", err)
+	}
+	utils.CloseFile(out)
+	defer os.Remove(out.Name())
+	runMigrationBinary(m.dir, binary, args, append(env, dryRunFileEnv+"="+out.Name()))
+	content, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not read the statements of the dry run: %s", err)
+	}
+	m.dry.Write(content)
 }
 
-func createMigrationsTableSQL(driver string) string {
-	switch driver {
-	case "mysql":
-		return MYSQLMigrationDDL
-	case "postgres":
-		return POSTGRESMigrationDDL
-	default:
-		return MYSQLMigrationDDL
+// getDialect returns the SQL dialect of the driver, exiting if it is not supported
+func getDialect(driver string) dialect.Dialect {
+	d, err := dialect.Get(driver)
+	if err != nil {
+		beeLogger.Log.Fatalf("%s", err)
 	}
+	return d
 }
 
-func selectMigrationsTableSQL(driver string) string {
-	switch driver {
-	case "mysql":
-		return "DESC migrations"
-	case "postgres":
-		return "SELECT * FROM migrations WHERE false ORDER BY id_migration;"
-	default:
-		return "DESC migrations"
+// hasMigrationsTable reports whether the migrations table exists
+func hasMigrationsTable(db *sql.DB, d dialect.Dialect) bool {
+	tables, err := d.Tables(db)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show migrations table: %s", err)
 	}
+	for _, table := range tables {
+		if table == "migrations" {
+			return true
+		}
+	}
+	return false
 }
 
-// getLatestMigration retrives latest migration with status 'update'
-func getLatestMigration(db *sql.DB, goal string) (file string, createdAt int64) {
-	sql := "SELECT name FROM migrations where status = 'update' ORDER BY id_migration DESC LIMIT 1"
-	if rows, err := db.Query(sql); err != nil {
-		beeLogger.Log.Fatalf("Could not retrieve migrations: %s", err)
-	} else {
-		if rows.Next() {
-			if err := rows.Scan(&file); err != nil {
-				beeLogger.Log.Fatalf("Could not read migrations in database: %s", err)
+// checkForSchemaUpdateTable checks the existence of migrations table.
+// It checks for the proper table structures and creates the table using the DDL of the dialect if it does not exist.
+func checkForSchemaUpdateTable(db *sql.DB, d dialect.Dialect) {
+	if !hasMigrationsTable(db, d) {
+		// No migrations table, create new ones
+		beeLogger.Log.Infof("Creating 'migrations' table...")
+
+		if _, err := db.Exec(d.MigrationsTableDDL()); err != nil {
+			beeLogger.Log.Fatalf("Could not create migrations table: %s", err)
+		}
+	}
+
+	// Checking that migrations table schema are expected
+	columns, err := d.Columns(db, "migrations")
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show columns of migrations table: %s", err)
+	}
+	hasChecksum := false
+	for _, c := range columns {
+		goType, _ := d.GoType(c.DataType)
+		switch c.Name {
+		case "id_migration":
+			if !c.PrimaryKey || !c.AutoIncrement {
+				beeLogger.Log.Hint("Expecting an auto-incremented primary key")
+				beeLogger.Log.Fatalf("Column migration.id_migration type mismatch: TYPE: %s, PRIMARY KEY: %t, AUTO INCREMENT: %t", c.ColumnType, c.PrimaryKey, c.AutoIncrement)
 			}
-			createdAtStr := file[len(file)-15:]
-			if t, err := time.Parse("20060102_150405", createdAtStr); err != nil {
-				beeLogger.Log.Fatalf("Could not parse time: %s", err)
-			} else {
-				createdAt = t.Unix()
+		case "name":
+			if goType != "string" || !c.Nullable {
+				beeLogger.Log.Hint("Expecting TYPE: varchar, NULL: YES")
+				beeLogger.Log.Fatalf("Column migration.name type mismatch: TYPE: %s, NULL: %t", c.ColumnType, c.Nullable)
 			}
-		} else {
-			// migration table has no 'update' record, no point rolling back
-			if goal == "rollback" {
-				beeLogger.Log.Fatal("There is nothing to rollback")
+		case "created_at":
+			if goType != "time.Time" || !dialect.IsCurrentTimestamp(c.Default) {
+				beeLogger.Log.Hint("Expecting TYPE: timestamp, DEFAULT: CURRENT_TIMESTAMP")
+				beeLogger.Log.Fatalf("Column migration.timestamp type mismatch: TYPE: %s, DEFAULT: %s", c.ColumnType, c.Default)
 			}
-			file, createdAt = "", 0
+		case "checksum":
+			hasChecksum = true
 		}
 	}
-	return
-}
-
-// writeMigrationSourceFile create the source file based on MIGRATION_MAIN_TPL
-func writeMigrationSourceFile(dir, source, driver, connStr string, latestTime int64, latestName string, task string) {
-	changeDir(dir)
-	if f, err := os.OpenFile(source, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err != nil {
-		beeLogger.Log.Fatalf("Could not create file: %s", err)
-	} else {
-		content := strings.Replace(MigrationMainTPL, "{{DBDriver}}", driver, -1)
-		content = strings.Replace(content, "{{ConnStr}}", connStr, -1)
-		content = strings.Replace(content, "{{LatestTime}}", strconv.FormatInt(latestTime, 10), -1)
-		content = strings.Replace(content, "{{LatestName}}", latestName, -1)
-		content = strings.Replace(content, "{{Task}}", task, -1)
-		if _, err := f.WriteString(content); err != nil {
-			beeLogger.Log.Fatalf("Could not write to file: %s", err)
+	if !hasChecksum {
+		// Migrations table of an older bee
+		beeLogger.Log.Infof("Adding 'checksum' column to 'migrations' table...")
+		if _, err := db.Exec(d.MigrationsChecksumDDL()); err != nil {
+			beeLogger.Log.Fatalf("Could not add checksum column to migrations table: %s", err)
 		}
-		utils.CloseFile(f)
 	}
 }
 
-// buildMigrationBinary changes directory to database/migrations folder and go-build the source
-func buildMigrationBinary(dir, binary string) {
-	changeDir(dir)
-	cmd := exec.Command("go", "build", "-o", binary)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		beeLogger.Log.Errorf("Could not build migration binary: %s", err)
-		formatShellErrOutput(string(out))
-		removeTempFile(dir, binary)
-		removeTempFile(dir, binary+".go")
-		os.Exit(2)
-	}
+// migrationMainSourceContent returns the source of the main file of the binary based on MigrationMainTPL
+func migrationMainSourceContent(d dialect.Dialect, driver string) []byte {
+	content := strings.Replace(MigrationMainTPL, "{{DBDriver}}", driver, -1)
+	content = strings.Replace(content, "{{DriverPkg}}", d.DriverPackage(), -1)
+	content = strings.Replace(content, "{{ConnEnv}}", connEnv, -1)
+	return []byte(content)
 }
 
-// runMigrationBinary runs the migration program who does the actual work
-func runMigrationBinary(dir, binary string) {
-	changeDir(dir)
-	cmd := exec.Command("./" + binary)
+// runMigrationBinary runs the migration program who does the actual work, in the migrations
+// directory, with the task and the names of the migrations as arguments
+func runMigrationBinary(dir, binary string, args, env []string) {
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		formatShellOutput(string(out))
 		beeLogger.Log.Errorf("Could not run migration binary: %s", err)
-		removeTempFile(dir, binary)
-		removeTempFile(dir, binary+".go")
 		os.Exit(2)
 	} else {
 		formatShellOutput(string(out))
 	}
 }
 
-// changeDir changes working directory to dir.
-// It exits the system when encouter an error
-func changeDir(dir string) {
-	if err := os.Chdir(dir); err != nil {
-		beeLogger.Log.Fatalf("Could not find migration directory: %s", err)
-	}
-}
-
-// removeTempFile removes a file in dir
-func removeTempFile(dir, file string) {
-	changeDir(dir)
-	if err := os.Remove(file); err != nil {
-		beeLogger.Log.Warnf("Could not remove temporary file: %s", err)
-	}
-}
-
 // formatShellErrOutput formats the error shell output
 func formatShellErrOutput(o string) {
 	for _, line := range strings.Split(o, "\n") {
@@ -346,79 +484,58 @@ import(
 	"github.com/astaxie/beego/orm"
 	"github.com/astaxie/beego/migration"
 
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/lib/pq"
+	_ "{{DriverPkg}}"
 )
 
-func init(){
-	orm.RegisterDataBase("default", "{{DBDriver}}","{{ConnStr}}")
-}
-
 func main(){
-	task := "{{Task}}"
-	switch task {
+	orm.RegisterDataBase("default", "{{DBDriver}}", os.Getenv("{{ConnEnv}}"))
+	if len(os.Args) < 2 {
+		os.Exit(2)
+	}
+	switch os.Args[1] {
 	case "upgrade":
-		if err := migration.Upgrade({{LatestTime}}); err != nil {
-			os.Exit(2)
-		}
-	case "rollback":
-		if err := migration.Rollback("{{LatestName}}"); err != nil {
+		// Only the migrations to run are built in
+		if err := migration.Upgrade(0); err != nil {
 			os.Exit(2)
 		}
-	case "reset":
-		if err := migration.Reset(); err != nil {
-			os.Exit(2)
-		}
-	case "refresh":
-		if err := migration.Refresh(); err != nil {
-			os.Exit(2)
+	case "down":
+		for _, name := range os.Args[2:] {
+			if err := migration.Rollback(name); err != nil {
+				os.Exit(2)
+			}
 		}
 	}
 }
 
 `
-	// MYSQLMigrationDDL MySQL migration SQL
-	MYSQLMigrationDDL = `
-CREATE TABLE migrations (
-	id_migration int(10) unsigned NOT NULL AUTO_INCREMENT COMMENT 'surrogate key',
-	name varchar(255) DEFAULT NULL COMMENT 'migration name, unique',
-	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT 'date migrated or rolled back',
-	statements longtext COMMENT 'SQL statements for this migration',
-	rollback_statements longtext COMMENT 'SQL statment for rolling back migration',
-	status ENUM('update', 'rollback') COMMENT 'update indicates it is a normal migration while rollback means this migration is rolled back',
-	PRIMARY KEY (id_migration)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8
-`
-	// POSTGRESMigrationDDL Postgres migration SQL
-	POSTGRESMigrationDDL = `
-CREATE TYPE migrations_status AS ENUM('update', 'rollback');
-
-CREATE TABLE migrations (
-	id_migration SERIAL PRIMARY KEY,
-	name varchar(255) DEFAULT NULL,
-	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	statements text,
-	rollback_statements text,
-	status migrations_status
-)`
 )
 
 // MigrateUpdate does the schema update
 func MigrateUpdate(currpath, driver, connStr string) {
-	migrate("upgrade", currpath, driver, connStr)
+	migrate("upgrade", currpath, driver, connStr, "", 0)
+}
+
+// MigrateUpTo does the schema update up to the target migration, included
+func MigrateUpTo(currpath, driver, connStr, target string) {
+	migrate("upgrade", currpath, driver, connStr, target, 0)
 }
 
 // MigrateRollback rolls back the latest migration
 func MigrateRollback(currpath, driver, connStr string) {
-	migrate("rollback", currpath, driver, connStr)
+	migrate("down", currpath, driver, connStr, "", 1)
+}
+
+// MigrateDown rolls back the given number of migrations, the latest first
+func MigrateDown(currpath, driver, connStr string, steps int) {
+	migrate("down", currpath, driver, connStr, "", steps)
 }
 
 // MigrateReset rolls back all migrations
 func MigrateReset(currpath, driver, connStr string) {
-	migrate("reset", currpath, driver, connStr)
+	migrate("reset", currpath, driver, connStr, "", 0)
 }
 
 // migrationRefresh rolls back all migrations and start over again
 func MigrateRefresh(currpath, driver, connStr string) {
-	migrate("refresh", currpath, driver, connStr)
+	migrate("refresh", currpath, driver, connStr, "", 0)
 }
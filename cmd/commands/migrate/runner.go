@@ -0,0 +1,232 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+	"github.com/ClearGrass/qpbee/utils"
+)
+
+const (
+	// mainSource is the main file of the migration binary
+	mainSource = "m.go"
+	// connEnv is the environment variable of the connection string of the migration binary
+	connEnv = "BEE_MIGRATE_CONN"
+	// runnerCacheTTL is how long an unused migration binary stays in the cache
+	runnerCacheTTL = 7 * 24 * time.Hour
+)
+
+// runnerCacheDir returns the directory of the migration binaries, named after the hash of their
+// sources, in the cache directory of the user, e.g. ~/.cache/bee/migrate. It returns an empty
+// string if the user has none.
+func runnerCacheDir() string {
+	var dir string
+	switch runtime.GOOS {
+	case "windows":
+		dir = os.Getenv("LocalAppData")
+	case "darwin":
+		if home := os.Getenv("HOME"); home != "" {
+			dir = path.Join(home, "Library", "Caches")
+		}
+	default:
+		dir = os.Getenv("XDG_CACHE_HOME")
+		if home := os.Getenv("HOME"); dir == "" && home != "" {
+			dir = path.Join(home, ".cache")
+		}
+	}
+	if dir == "" {
+		return ""
+	}
+	return path.Join(dir, "bee", "migrate")
+}
+
+// readSource returns the content of a source file of the migration binary
+func readSource(dir, file string) []byte {
+	content, err := ioutil.ReadFile(path.Join(dir, file))
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not read migration file: %s", err)
+	}
+	return content
+}
+
+// buildMigrationBinary returns the migration binary of the given sources, by file name.
+// It is built in a private directory of the migrations directory, so that the vendor
+// directories, the module and the replaced modules of the application are used as
+// they are, and cached by the hash of its sources and of the packages they import.
+func buildMigrationBinary(dir string, sources map[string][]byte) string {
+	if _, err := exec.LookPath("go"); err != nil {
+		beeLogger.Log.Fatalf("Could not find the go command to build the Go migrations: %s", err)
+	}
+	files := make([]string, 0, len(sources))
+	for file := range sources {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	// Hidden, so that neither the go command nor bee run look into it
+	buildDir, err := ioutil.TempDir(dir, ".bee-build-")
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(buildDir)
+	for _, file := range files {
+		if err := ioutil.WriteFile(path.Join(buildDir, file), sources[file], 0600); err != nil {
+			os.RemoveAll(buildDir)
+			beeLogger.Log.Fatalf("Could not write to file: %s", err)
+		}
+	}
+
+	h := sha256.New()
+	for _, env := range []string{"GOPATH", "GO111MODULE", "GOFLAGS"} {
+		fmt.Fprintf(h, "%s=%s\x00", env, os.Getenv(env))
+	}
+	h.Write([]byte(dir))
+	for _, file := range files {
+		h.Write([]byte{0})
+		h.Write([]byte(file))
+		h.Write([]byte{0})
+		h.Write(sources[file])
+	}
+	stampImports(h, buildDir, files)
+	binary := "m-" + hex.EncodeToString(h.Sum(nil))[:16]
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+
+	// The binary is run with the connection string in its environment, so the
+	// cache must be one nobody else can put a binary in
+	cacheDir := runnerCacheDir()
+	if cacheDir == "" {
+		os.RemoveAll(buildDir)
+		beeLogger.Log.Fatal("Could not find the cache directory of the user to build the migration binary in, HOME is not set")
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		os.RemoveAll(buildDir)
+		beeLogger.Log.Fatalf("Could not create directory: %s", err)
+	}
+	if err := checkPrivateDir(cacheDir); err != nil {
+		os.RemoveAll(buildDir)
+		beeLogger.Log.Fatalf("Refusing to use the migration binaries of '%s': %s", cacheDir, err)
+	}
+	binary = path.Join(cacheDir, binary)
+
+	if _, err := os.Stat(binary); err == nil {
+		beeLogger.Log.Info("Using cached migration binary")
+		now := time.Now()
+		os.Chtimes(binary, now, now)
+		return binary
+	}
+	pruneRunnerCache(cacheDir)
+
+	beeLogger.Log.Info("Building migration binary...")
+	// Built next to the cached one, then moved, so that a failed build is never used
+	f, err := ioutil.TempFile(cacheDir, path.Base(binary)+".tmp")
+	if err != nil {
+		os.RemoveAll(buildDir)
+		beeLogger.Log.Fatalf("Could not create file: %s", err)
+	}
+	utils.CloseFile(f)
+	tmp := f.Name()
+	cmd := exec.Command("go", append([]string{"build", "-o", tmp}, files...)...)
+	cmd.Dir = buildDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		beeLogger.Log.Errorf("Could not build migration binary: %s", err)
+		formatShellErrOutput(string(out))
+		os.RemoveAll(buildDir)
+		os.Remove(tmp)
+		os.Exit(2)
+	}
+	if err := os.Rename(tmp, binary); err != nil {
+		os.RemoveAll(buildDir)
+		os.Remove(tmp)
+		beeLogger.Log.Fatalf("Could not cache migration binary: %s", err)
+	}
+	return binary
+}
+
+// stampImports writes to h the go.mod and go.sum of the module of the build directory, if any,
+// and the files, sizes and modification times of the packages the Go files import, in the
+// directories the go command resolves them to, e.g. a vendor directory, so that the binary
+// is built again once they are updated, e.g. by "go get -u"
+func stampImports(h hash.Hash, buildDir string, files []string) {
+	if found, modRoot, _ := utils.SearchGoMod(buildDir); found {
+		for _, file := range []string{"go.mod", "go.sum"} {
+			content, _ := ioutil.ReadFile(path.Join(modRoot, file))
+			fmt.Fprintf(h, "\x00%s\x00%s", file, content)
+		}
+	}
+
+	// Errors are reported by the build
+	imports := goList(buildDir, "{{join .Imports \"\\n\"}}", files)
+	if len(imports) == 0 {
+		return
+	}
+	for _, pkgDir := range goList(buildDir, "{{if not .Standard}}{{.Dir}}{{end}}", imports) {
+		infos, err := ioutil.ReadDir(pkgDir)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(h, "\x00%s", pkgDir)
+		for _, info := range infos {
+			if !info.IsDir() {
+				fmt.Fprintf(h, "\x00%s %d %d", info.Name(), info.Size(), info.ModTime().UnixNano())
+			}
+		}
+	}
+}
+
+// goList returns the non-empty lines "go list" prints for the given packages with the given
+// format, run in dir. It returns nil if the packages cannot be listed.
+func goList(dir, format string, args []string) []string {
+	cmd := exec.Command("go", append([]string{"list", "-e", "-f", format}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// pruneRunnerCache removes the migration binaries unused for longer than runnerCacheTTL
+func pruneRunnerCache(dir string) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if time.Since(info.ModTime()) > runnerCacheTTL {
+			os.Remove(path.Join(dir, info.Name()))
+		}
+	}
+}
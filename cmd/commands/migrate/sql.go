@@ -0,0 +1,171 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package migrate
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ClearGrass/qpbee/dialect"
+
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+)
+
+// downFile returns the .down.sql file of an SQL migration
+func downFile(m migrationFile) string {
+	return strings.TrimSuffix(m.file, ".up.sql") + ".down.sql"
+}
+
+// readStatements returns the statements of an SQL migration file
+func readStatements(d dialect.Dialect, dir, file string) []string {
+	content, err := ioutil.ReadFile(path.Join(dir, file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			beeLogger.Log.Fatalf("Could not find migration file '%s'", file)
+		}
+		beeLogger.Log.Fatalf("Could not read migration file: %s", err)
+	}
+	return splitStatements(string(content), d.BackslashEscapes())
+}
+
+// runSQLMigration applies an SQL migration, or rolls it back, and records it in the
+// migrations table the way the Go migrations are, within a single transaction.
+// MySQL commits the DDL statements implicitly though.
+func runSQLMigration(db *sql.DB, d dialect.Dialect, dir string, m migrationFile, goal string) {
+	var (
+		statements []string
+		record     string
+		args       []interface{}
+	)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	if goal == "upgrade" {
+		beeLogger.Log.Infof("|> start upgrade %s", m.name)
+		statements = readStatements(d, dir, m.file)
+		record = "INSERT INTO migrations (name, statements, created_at, status, checksum) VALUES (" +
+			d.Placeholder(1) + ", " + d.Placeholder(2) + ", " + d.Placeholder(3) + ", 'update', " + d.Placeholder(4) + ")"
+		args = []interface{}{m.name, strings.Join(statements, ";\n"), now, fileChecksum(dir, m.file)}
+	} else {
+		beeLogger.Log.Infof("|> start rollback %s", m.name)
+		statements = readStatements(d, dir, downFile(m))
+		record = "UPDATE migrations SET status = 'rollback', rollback_statements = " + d.Placeholder(1) +
+			", created_at = " + d.Placeholder(2) + " WHERE name = " + d.Placeholder(3)
+		args = []interface{}{strings.Join(statements, ";\n"), now, m.name}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not start transaction: %s", err)
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			beeLogger.Log.Errorf("Could not execute statement of '%s': %s", m.name, statement)
+			beeLogger.Log.Fatalf("%s", err)
+		}
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		tx.Rollback()
+		beeLogger.Log.Fatalf("Could not record migration '%s': %s", m.name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		beeLogger.Log.Fatalf("Could not commit migration '%s': %s", m.name, err)
+	}
+	beeLogger.Log.Infof("|> end %s: %s", goal, m.name)
+}
+
+// splitStatements splits SQL into its statements, on the semicolons outside of the quoted
+// strings, the comments and the dollar-quoted bodies of PostgreSQL. A backslash escapes
+// the next character of the strings if backslashEscapes is set, as in MySQL, and of the
+// E'...' strings of PostgreSQL. The statements holding only comments are dropped.
+func splitStatements(s string, backslashEscapes bool) []string {
+	var (
+		statements []string
+		start      int
+		empty      = true // Only spaces and comments since start.
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(s)
+			}
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			if end := strings.Index(s[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(s)
+			}
+		case c == '\'' || c == '"' || c == '`':
+			empty = false
+			escapes := backslashEscapes && c != '`' ||
+				c == '\'' && i > 0 && (s[i-1] == 'E' || s[i-1] == 'e') && (i == 1 || !isIdentByte(s[i-2]))
+			// A doubled quote escapes itself, as the end of a string and the start of another
+			for i++; i < len(s) && s[i] != c; i++ {
+				if escapes && s[i] == '\\' {
+					i++
+				}
+			}
+		case c == '$' && dollarQuote(s, i) != "":
+			empty = false
+			tag := dollarQuote(s, i)
+			if end := strings.Index(s[i+len(tag):], tag); end >= 0 {
+				i += len(tag) + end + len(tag) - 1
+			} else {
+				i = len(s)
+			}
+		case c == ';':
+			if !empty {
+				statements = append(statements, strings.TrimSpace(s[start:i]))
+			}
+			start, empty = i+1, true
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			empty = false
+		}
+	}
+	if !empty {
+		statements = append(statements, strings.TrimSpace(s[start:]))
+	}
+	return statements
+}
+
+// dollarQuote returns the $tag$ or $$ opening a dollar-quoted string of PostgreSQL at s[i],
+// or an empty string if there is none, e.g. for $1 or an identifier holding a $
+func dollarQuote(s string, i int) string {
+	if i > 0 && isIdentByte(s[i-1]) {
+		return ""
+	}
+	j := i + 1
+	for ; j < len(s) && s[j] != '$'; j++ {
+		if !isIdentByte(s[j]) || j == i+1 && s[j] >= '0' && s[j] <= '9' {
+			return ""
+		}
+	}
+	if j == len(s) {
+		return ""
+	}
+	return s[i : j+1]
+}
+
+// isIdentByte reports whether b can be part of an unquoted identifier
+func isIdentByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_' || b == '$' || b >= 0x80
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name             string
+		sql              string
+		backslashEscapes bool
+		want             []string
+	}{
+		{
+			name: "statements",
+			sql:  "CREATE TABLE a (id int);\n\nINSERT INTO a VALUES (1) ;INSERT INTO a VALUES (2)",
+			want: []string{"CREATE TABLE a (id int)", "INSERT INTO a VALUES (1)", "INSERT INTO a VALUES (2)"},
+		},
+		{
+			name: "empty statements and comments",
+			sql:  "-- Creates a;\n;CREATE TABLE a (id int); /* ; */ ;\n-- end",
+			want: []string{"CREATE TABLE a (id int)"},
+		},
+		{
+			name: "quoted semicolons",
+			sql:  "INSERT INTO a VALUES ('x;y', \"z;\", `w;`);SELECT 1",
+			want: []string{"INSERT INTO a VALUES ('x;y', \"z;\", `w;`)", "SELECT 1"},
+		},
+		{
+			name: "doubled quotes",
+			sql:  "INSERT INTO a VALUES ('it''s;');SELECT 1",
+			want: []string{"INSERT INTO a VALUES ('it''s;')", "SELECT 1"},
+		},
+		{
+			name:             "backslash escapes",
+			sql:              `INSERT INTO a VALUES ('it\'s;');SELECT 1`,
+			backslashEscapes: true,
+			want:             []string{`INSERT INTO a VALUES ('it\'s;')`, "SELECT 1"},
+		},
+		{
+			name: "backslash ends a literal",
+			sql:  `INSERT INTO a VALUES ('C:\');INSERT INTO a VALUES ('D:\')`,
+			want: []string{`INSERT INTO a VALUES ('C:\')`, `INSERT INTO a VALUES ('D:\')`},
+		},
+		{
+			name: "escape string",
+			sql:  `INSERT INTO a VALUES (E'it\'s;');INSERT INTO a VALUES (e'\\');SELECT 1`,
+			want: []string{`INSERT INTO a VALUES (E'it\'s;')`, `INSERT INTO a VALUES (e'\\')`, "SELECT 1"},
+		},
+		{
+			name: "dollar quotes",
+			sql:  "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;SELECT 1",
+			want: []string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "SELECT 1"},
+		},
+		{
+			name: "tagged dollar quotes",
+			sql:  "CREATE FUNCTION f() RETURNS int AS $fn$ BEGIN RETURN $$;$$; END; $fn$ LANGUAGE plpgsql;SELECT 1",
+			want: []string{"CREATE FUNCTION f() RETURNS int AS $fn$ BEGIN RETURN $$;$$; END; $fn$ LANGUAGE plpgsql", "SELECT 1"},
+		},
+		{
+			name: "positional parameters and identifiers",
+			sql:  "PREPARE p AS SELECT $1, a$b$c FROM t;SELECT 2",
+			want: []string{"PREPARE p AS SELECT $1, a$b$c FROM t", "SELECT 2"},
+		},
+		{
+			name: "unterminated string",
+			sql:  "SELECT 'a;b",
+			want: []string{"SELECT 'a;b"},
+		},
+	}
+
+	for _, test := range tests {
+		got := splitStatements(test.sql, test.backslashEscapes)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSQLMigrationName(t *testing.T) {
+	tests := []struct {
+		file string
+		name string
+		ok   bool
+	}{
+		{"20170102_150405_create_posts.up.sql", "CreatePosts_20170102_150405", true},
+		{"20170102_150405_posts.up.sql", "Posts_20170102_150405", true},
+		{"20170102_150405_.up.sql", "", false},
+		{"20170102_150405.up.sql", "", false},
+		{"20171302_150405_posts.up.sql", "", false},
+		{"20170102-150405_posts.up.sql", "", false},
+		{"create_posts.up.sql", "", false},
+	}
+
+	for _, test := range tests {
+		name, ok := sqlMigrationName(test.file)
+		if name != test.name || ok != test.ok {
+			t.Errorf("%s: got %q, %v, want %q, %v", test.file, name, ok, test.name, test.ok)
+		}
+	}
+}
+
+func TestFindMigration(t *testing.T) {
+	files := []migrationFile{
+		{name: "Users_20170101_120000", file: "20170101_120000_users.go"},
+		{name: "CreatePosts_20170102_150405", file: "20170102_150405_create_posts.up.sql", sql: true},
+	}
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"Users_20170101_120000", 0},
+		{"20170101_120000_users.go", 0},
+		{"20170101_120000_users", 0},
+		{"CreatePosts_20170102_150405", 1},
+		{"20170102_150405_create_posts.up.sql", 1},
+		{"20170102_150405_create_posts", 1},
+		{"20170102_150405_create_posts.down.sql", -1},
+		{"users", -1},
+		{"", -1},
+	}
+
+	for _, test := range tests {
+		if got := findMigration(files, test.target); got != test.want {
+			t.Errorf("%q: got %d, want %d", test.target, got, test.want)
+		}
+	}
+}
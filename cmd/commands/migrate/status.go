@@ -0,0 +1,228 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ClearGrass/qpbee/dialect"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+	"github.com/ClearGrass/qpbee/utils"
+)
+
+// timestampFormat is the format of the creation time starting the migration file names
+const timestampFormat = "20060102_150405"
+
+// registerRegExp matches the name a migration file registers its migration under
+var registerRegExp = regexp.MustCompile(`migration\.Register\(\s*"([^"]+)"`)
+
+// migrationFile is a migration of the database/migrations directory
+type migrationFile struct {
+	name string // Name the migration is registered and recorded under.
+	file string // The .go file, or the .up.sql file of an SQL migration.
+	sql  bool
+}
+
+// migrationRecord is the state of a migration in the migrations table
+type migrationRecord struct {
+	name      string
+	createdAt string // Date migrated or rolled back.
+	status    string // "update" or "rollback".
+	checksum  string // Checksum of the file when applied, empty if not recorded.
+}
+
+// listMigrations returns the migrations of the directory, Go and SQL ones
+// together, sorted by file name, which starts with their creation time.
+// It also returns the other Go files of the directory, which the Go
+// migrations may depend on.
+func listMigrations(dir string) (migrations []migrationFile, others []string) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not find migration directory: %s", err)
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".up.sql") {
+			m, ok := sqlMigrationName(name)
+			if !ok {
+				beeLogger.Log.Warnf("Skipping '%s', it is not named <%s>_<name>.up.sql", name, timestampFormat)
+				continue
+			}
+			migrations = append(migrations, migrationFile{name: m, file: name, sql: true})
+			continue
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == "m.go" {
+			continue
+		}
+		content, err := ioutil.ReadFile(path.Join(dir, name))
+		if err != nil {
+			beeLogger.Log.Fatalf("Could not read migration file: %s", err)
+		}
+		m := registerRegExp.FindSubmatch(content)
+		if m == nil {
+			others = append(others, name)
+			continue
+		}
+		migrations = append(migrations, migrationFile{name: string(m[1]), file: name})
+	}
+	return
+}
+
+// sqlMigrationName returns the name an SQL migration file is recorded under,
+// named like the Go migrations, e.g. CreatePosts_20170102_150405 for
+// 20170102_150405_create_posts.up.sql
+func sqlMigrationName(file string) (string, bool) {
+	base := strings.TrimSuffix(file, ".up.sql")
+	n := len(timestampFormat)
+	if len(base) <= n+1 || base[n] != '_' {
+		return "", false
+	}
+	if _, err := time.Parse(timestampFormat, base[:n]); err != nil {
+		return "", false
+	}
+	return utils.CamelCase(base[n+1:]) + "_" + base[:n], true
+}
+
+// findMigration returns the index of the migration named after its registered
+// name or its file name, with or without the .go or .up.sql extension
+func findMigration(files []migrationFile, target string) int {
+	for i, f := range files {
+		if f.name == target || f.file == target || strings.TrimSuffix(strings.TrimSuffix(f.file, ".go"), ".up.sql") == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// getMigrationRecords returns the latest record of each migration of the
+// migrations table, in the order they were migrated
+func getMigrationRecords(db *sql.DB, d dialect.Dialect) []migrationRecord {
+	columns, err := d.Columns(db, "migrations")
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show columns of migrations table: %s", err)
+	}
+	checksum := "NULL" // Migrations table of an older bee
+	for _, c := range columns {
+		if c.Name == "checksum" {
+			checksum = c.Name
+		}
+	}
+	rows, err := db.Query("SELECT name, created_at, status, " + checksum + " FROM migrations ORDER BY id_migration")
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not retrieve migrations: %s", err)
+	}
+	defer rows.Close()
+
+	var all []migrationRecord
+	for rows.Next() {
+		var name, createdAt, status, checksum sql.NullString
+		if err := rows.Scan(&name, &createdAt, &status, &checksum); err != nil {
+			beeLogger.Log.Fatalf("Could not read migrations in database: %s", err)
+		}
+		all = append(all, migrationRecord{name: name.String, createdAt: createdAt.String, status: status.String, checksum: checksum.String})
+	}
+	if err := rows.Err(); err != nil {
+		beeLogger.Log.Fatalf("Could not read migrations in database: %s", err)
+	}
+
+	// A migration applied again after a rollback has several records
+	var (
+		records []migrationRecord
+		seen    = make(map[string]bool)
+	)
+	for i := len(all) - 1; i >= 0; i-- {
+		if !seen[all[i].name] {
+			seen[all[i].name] = true
+			records = append([]migrationRecord{all[i]}, records...)
+		}
+	}
+	return records
+}
+
+// getAppliedMigrations returns the names of the last applied migrations, the latest first,
+// all of them if steps is negative
+func getAppliedMigrations(records []migrationRecord, steps int) []string {
+	var names []string
+	for i := len(records) - 1; i >= 0 && (steps < 0 || len(names) < steps); i-- {
+		if records[i].status == "update" {
+			names = append(names, records[i].name)
+		}
+	}
+	return names
+}
+
+// MigrateStatus prints the migrations of the database/migrations directory
+// along with the time they were applied or rolled back, followed by the
+// migrations of the migrations table missing from the directory. It leaves
+// the schema as it is, the migrations table included.
+func MigrateStatus(currpath, driver, connStr string) {
+	dir := path.Join(currpath, "database", "migrations")
+	files, _ := listMigrations(dir)
+
+	d := getDialect(driver)
+	db, err := sql.Open(d.Name(), connStr)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not connect to database using '%s': %s", connStr, err)
+	}
+	defer db.Close()
+
+	// Read-only: without migrations table, every migration is pending
+	var records []migrationRecord
+	if hasMigrationsTable(db, d) {
+		records = getMigrationRecords(db, d)
+	}
+	byName := make(map[string]migrationRecord, len(records))
+	for _, r := range records {
+		byName[r.name] = r
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tAPPLIED AT\tSTATUS")
+	pending := 0
+	for _, f := range files {
+		r, ok := byName[f.name]
+		if !ok {
+			fmt.Fprintf(w, "%s\t-\tpending\n", f.name)
+			pending++
+			continue
+		}
+		delete(byName, f.name)
+		status := r.status
+		if r.status == "update" && r.checksum != "" && r.checksum != fileChecksum(dir, f.file) {
+			status += " (changed)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.name, r.createdAt, status)
+	}
+	for _, r := range records {
+		if _, ok := byName[r.name]; ok {
+			fmt.Fprintf(w, "%s\t%s\t%s (file missing)\n", r.name, r.createdAt, r.status)
+		}
+	}
+	w.Flush()
+
+	beeLogger.Log.Infof("%d migration(s), %d pending", len(files), pending)
+}
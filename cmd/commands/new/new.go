@@ -22,8 +22,10 @@ import (
 
 	"github.com/ClearGrass/qpbee/cmd/commands"
 	"github.com/ClearGrass/qpbee/cmd/commands/version"
+	"github.com/ClearGrass/qpbee/config"
 	beeLogger "github.com/ClearGrass/qpbee/logger"
 	"github.com/ClearGrass/qpbee/logger/colors"
+	"github.com/ClearGrass/qpbee/reload"
 	"github.com/ClearGrass/qpbee/utils"
 )
 
@@ -241,9 +243,6 @@ var indextpl = `<!DOCTYPE html>
 </html>
 `
 
-var reloadJsClient = `function b(a){var c=new WebSocket(a);c.onclose=function(){setTimeout(function(){b(a)},2E3)};c.onmessage=function(){location.reload()}}try{if(window.WebSocket)try{b("ws://localhost:12450/reload")}catch(a){console.error(a)}else console.log("Your browser does not support WebSockets.")}catch(a){console.error("Exception during connecting to Reload:",a)};
-`
-
 func init() {
 	commands.AvailableCommands = append(commands.AvailableCommands, CmdNew)
 }
@@ -271,6 +270,11 @@ func CreateApp(cmd *commands.Command, args []string) int {
 
 	os.MkdirAll(apppath, 0755)
 	fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", apppath+string(path.Separator), "\x1b[0m")
+	if utils.NeedsGoMod(apppath) {
+		fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "go.mod"), "\x1b[0m")
+		utils.WriteToFile(path.Join(apppath, "go.mod"), utils.GoModContent(packpath))
+		beeLogger.Log.Hint("Run 'go mod tidy' inside the application directory to fetch its dependencies")
+	}
 	os.Mkdir(path.Join(apppath, "conf"), 0755)
 	fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "conf")+string(path.Separator), "\x1b[0m")
 	os.Mkdir(path.Join(apppath, "controllers"), 0755)
@@ -284,7 +288,7 @@ func CreateApp(cmd *commands.Command, args []string) int {
 	os.Mkdir(path.Join(apppath, "static"), 0755)
 	fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "static")+string(path.Separator), "\x1b[0m")
 	os.Mkdir(path.Join(apppath, "static", "js"), 0755)
-	utils.WriteToFile(path.Join(apppath, "static", "js", "reload.min.js"), reloadJsClient)
+	utils.WriteToFile(path.Join(apppath, "static", "js", "reload.min.js"), reload.Client(config.Conf.Reload.Port))
 	fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "static", "js")+string(path.Separator), "\x1b[0m")
 	os.Mkdir(path.Join(apppath, "static", "css"), 0755)
 	fmt.Fprintf(output, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", path.Join(apppath, "static", "css")+string(path.Separator), "\x1b[0m")
@@ -0,0 +1,123 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	path "path/filepath"
+
+	"github.com/ClearGrass/qpbee/config"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+)
+
+// loadBuildSettings applies the build flags to the build settings of the configuration
+// file, and creates the directories of the binaries and of the coverage data.
+func loadBuildSettings() {
+	b := &config.Conf.Build
+	if buildTags == "" {
+		buildTags = b.Tags
+	}
+	if ldflags != "" {
+		b.Ldflags = ldflags
+	}
+	if gcflags != "" {
+		b.Gcflags = gcflags
+	}
+	if modFlag != "" {
+		b.Mod = modFlag
+	}
+	if buildOutput != "" {
+		b.Output = buildOutput
+	}
+	b.Race = b.Race || raceBuild
+	b.Cover = b.Cover || coverBuild
+	b.Envs = mergeEnv(b.Envs, []string(buildEnvs))
+
+	if err := os.MkdirAll(buildDir(), 0755); err != nil {
+		beeLogger.Log.Fatalf("Failed to create the build directory: %s", err)
+	}
+	beeLogger.Log.Infof("Building into %s", buildDir())
+	if b.Cover {
+		if err := os.MkdirAll(coverDir(), 0755); err != nil {
+			beeLogger.Log.Fatalf("Failed to create the coverage directory: %s", err)
+		}
+		beeLogger.Log.Infof("Writing coverage data to %s", coverDir())
+	}
+}
+
+// buildDir returns the directory of the binaries. Unless set, it is a
+// directory of the system's temporary directory dedicated to the application.
+func buildDir() string {
+	if dir := config.Conf.Build.Output; dir != "" {
+		return absPath(dir)
+	}
+	sum := md5.Sum([]byte(currpath))
+	return path.Join(os.TempDir(), "bee-run", appname+"-"+hex.EncodeToString(sum[:4]))
+}
+
+// coverDir returns the directory the coverage-instrumented binaries write to
+func coverDir() string {
+	if dir := config.Conf.Build.CoverDir; dir != "" {
+		return absPath(dir)
+	}
+	return path.Join(buildDir(), "coverage")
+}
+
+// absPath resolves a path relative to the application
+func absPath(p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join(currpath, p)
+}
+
+// buildArgs returns the flags of "go build" for the build settings
+func buildArgs() []string {
+	b := config.Conf.Build
+
+	var args []string
+	if buildTags != "" {
+		args = append(args, "-tags", buildTags)
+	}
+	if b.Race {
+		args = append(args, "-race")
+	}
+	if b.Cover {
+		args = append(args, "-cover")
+		if b.CoverPkg != "" {
+			args = append(args, "-coverpkg", b.CoverPkg)
+		}
+	}
+	if b.Mod != "" {
+		args = append(args, "-mod="+b.Mod)
+	}
+	if b.Ldflags != "" {
+		args = append(args, "-ldflags", os.ExpandEnv(b.Ldflags))
+	}
+	if b.Gcflags != "" {
+		args = append(args, "-gcflags", b.Gcflags)
+	}
+	return append(args, b.Flags...)
+}
+
+// processEnv returns the extra environment of the processes of a build
+func processEnv() []string {
+	if config.Conf.Build.Cover {
+		return []string{"GOCOVERDIR=" + coverDir()}
+	}
+	return nil
+}
@@ -0,0 +1,446 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClearGrass/qpbee/config"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+)
+
+const (
+	outputBufferLines = 1000 // Lines of application output kept for the control API.
+	defaultLogLines   = 50   // Lines of application output returned by default.
+
+	// Header required by the control API, which cannot be set by
+	// cross-origin requests of web pages.
+	controlHeader = "X-Bee-Control"
+)
+
+// controlCommands are the "bee run -control" arguments talking to the control
+// API of a running session, with the HTTP method of their endpoint.
+var controlCommands = map[string]string{
+	"status":  "GET",
+	"logs":    "GET",
+	"rebuild": "POST",
+	"restart": "POST",
+	"pause":   "POST",
+	"resume":  "POST",
+}
+
+var (
+	appOutput = &outputBuffer{} // The last lines written by the application.
+
+	stateMu       sync.Mutex
+	paused        bool         // The watcher ignores changes.
+	missedChanges bool         // Changes were ignored while paused.
+	lastBuild     *buildResult // Result of the latest build.
+	appStartedAt  time.Time    // Start time of the application process.
+	appBuildHash  string       // Hash of the binary of the application process.
+)
+
+// buildResult describes the outcome of a build
+type buildResult struct {
+	Status     string    `json:"status"`
+	Duration   float64   `json:"duration_ms"`
+	FinishedAt time.Time `json:"finished_at"`
+	Hash       string    `json:"hash,omitempty"` // MD5 hash of the built binary.
+}
+
+// controlStatus is the status reported by the control API
+type controlStatus struct {
+	App struct {
+		Name      string     `json:"name"`
+		PID       int        `json:"pid,omitempty"`
+		Running   bool       `json:"running"`
+		StartedAt *time.Time `json:"started_at,omitempty"`
+		Uptime    float64    `json:"uptime_s,omitempty"`
+		BuildHash string     `json:"build_hash,omitempty"`
+	} `json:"app"`
+	Processes    []processStatus `json:"processes,omitempty"` // The processes supervised along with the application.
+	LastBuild    *buildResult    `json:"last_build,omitempty"`
+	Paused       bool            `json:"paused"`
+	WatchedPaths []string        `json:"watched_paths"`
+}
+
+// processStatus is the status of a process supervised along with the application
+type processStatus struct {
+	Name    string `json:"name"`
+	PID     int    `json:"pid,omitempty"`
+	Running bool   `json:"running"`
+}
+
+// controlResponse is the response of the actions of the control API
+type controlResponse struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// outputBuffer keeps the last lines written by the application
+type outputBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		b.lines = append(b.lines, string(bytes.TrimRight(data[:i], "\r")))
+		data = data[i+1:]
+	}
+	b.partial = append([]byte(nil), data...)
+
+	// Trim once in a while rather than on each line
+	if len(b.lines) > 2*outputBufferLines {
+		b.lines = append([]string(nil), b.lines[len(b.lines)-outputBufferLines:]...)
+	}
+	return len(p), nil
+}
+
+// last returns the last n lines
+func (b *outputBuffer) last(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n > outputBufferLines {
+		n = outputBufferLines
+	}
+	if n > len(b.lines) {
+		n = len(b.lines)
+	}
+	return append([]string{}, b.lines[len(b.lines)-n:]...)
+}
+
+// binaryName returns the file name of the application binary
+func binaryName() string {
+	if runtime.GOOS == "windows" {
+		return appname + ".exe"
+	}
+	return appname
+}
+
+// binaryHash returns the MD5 hash of the application binary
+func binaryHash() string {
+	return hex.EncodeToString(hashFile(app.binary()))
+}
+
+// recordBuild records the result of a build for the control API
+func recordBuild(status string, duration float64) {
+	result := &buildResult{Status: status, Duration: duration, FinishedAt: time.Now()}
+	if status == statusOK {
+		result.Hash = binaryHash()
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	lastBuild = result
+}
+
+// recordStart records the start of the application process for the control API
+func recordStart() {
+	hash := binaryHash()
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	appStartedAt = time.Now()
+	appBuildHash = hash
+}
+
+// isPaused reports whether the watcher is paused. Changes detected while
+// paused are remembered to rebuild the application when resumed.
+func isPaused() bool {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if paused {
+		missedChanges = true
+	}
+	return paused
+}
+
+// startControlServer starts the control API on the loopback interface
+func startControlServer() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", handleStatus)
+	mux.HandleFunc("/logs", handleLogs)
+	mux.HandleFunc("/rebuild", controlAction(rebuildAction))
+	mux.HandleFunc("/restart", controlAction(restartAction))
+	mux.HandleFunc("/pause", controlAction(pauseAction))
+	mux.HandleFunc("/resume", controlAction(resumeAction))
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(config.Conf.Control.Port))
+	go func() {
+		if err := http.ListenAndServe(addr, controlGuard(mux)); err != nil {
+			beeLogger.Log.Errorf("Failed to start up the control API: %v", err)
+		}
+	}()
+	beeLogger.Log.Infof("Control API listening at %s", addr)
+}
+
+// controlGuard only lets through the requests with the control header and
+// the loopback address of the control API as host, so that neither a web
+// page nor a domain of it resolving to the loopback address (DNS rebinding)
+// can read the output of the application or act on it.
+func controlGuard(h http.Handler) http.Handler {
+	port := strconv.Itoa(config.Conf.Control.Port)
+	hosts := map[string]bool{
+		net.JoinHostPort("127.0.0.1", port): true,
+		net.JoinHostPort("localhost", port): true,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hosts[r.Host] {
+			writeJSON(w, http.StatusForbidden, controlResponse{Message: "invalid host " + r.Host})
+			return
+		}
+		if r.Header.Get(controlHeader) == "" {
+			writeJSON(w, http.StatusForbidden, controlResponse{Message: "the control API requires the " + controlHeader + " header"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	var status controlStatus
+	status.App.Name = appname
+
+	procMu.Lock()
+	p := app.proc
+	for _, prog := range programs[1:] {
+		ps := processStatus{Name: prog.name}
+		if prog.proc != nil && !prog.proc.exited() {
+			ps.PID = prog.proc.cmd.Process.Pid
+			ps.Running = true
+		}
+		status.Processes = append(status.Processes, ps)
+	}
+	procMu.Unlock()
+
+	stateMu.Lock()
+	if p != nil && !p.exited() {
+		startedAt := appStartedAt
+		status.App.PID = p.cmd.Process.Pid
+		status.App.Running = true
+		status.App.StartedAt = &startedAt
+		status.App.Uptime = time.Since(startedAt).Seconds()
+		status.App.BuildHash = appBuildHash
+	}
+	status.LastBuild = lastBuild
+	status.Paused = paused
+	stateMu.Unlock()
+
+	watchedMu.Lock()
+	status.WatchedPaths = make([]string, 0, len(watchedDirs))
+	for dir := range watchedDirs {
+		status.WatchedPaths = append(status.WatchedPaths, dir)
+	}
+	watchedMu.Unlock()
+	sort.Strings(status.WatchedPaths)
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func handleLogs(w http.ResponseWriter, r *http.Request) {
+	n := defaultLogLines
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, controlResponse{Message: "invalid number of lines: " + v})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"lines": appOutput.last(n)})
+}
+
+// controlAction serves an action of the control API, which must be
+// requested with POST.
+func controlAction(action func() (bool, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			writeJSON(w, http.StatusMethodNotAllowed, controlResponse{Message: "actions require POST"})
+			return
+		}
+		ok, msg := action()
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusConflict
+		}
+		writeJSON(w, status, controlResponse{OK: ok, Message: msg})
+	}
+}
+
+func rebuildAction() (bool, string) {
+	if scheduler == nil {
+		return false, "the watcher is not started yet"
+	}
+	beeLogger.Log.Info("Rebuild requested through the control API")
+	go scheduler.Trigger()
+	return true, "Rebuilding"
+}
+
+func restartAction() (bool, string) {
+	beeLogger.Log.Info("Restart requested through the control API")
+	go restartPrograms(programs)
+	return true, "Restarting"
+}
+
+func pauseAction() (bool, string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if paused {
+		return false, "the watcher is already paused"
+	}
+	paused = true
+	beeLogger.Log.Warn("Watcher paused, changes are ignored until resumed")
+	return true, "Paused"
+}
+
+func resumeAction() (bool, string) {
+	stateMu.Lock()
+	if !paused {
+		stateMu.Unlock()
+		return false, "the watcher is not paused"
+	}
+	missed := missedChanges
+	paused, missedChanges = false, false
+	stateMu.Unlock()
+
+	beeLogger.Log.Info("Watcher resumed")
+	if missed && scheduler != nil {
+		beeLogger.Log.Info("Rebuilding after the changes made while paused")
+		go scheduler.Trigger()
+		return true, "Resumed, rebuilding after the changes made while paused"
+	}
+	return true, "Resumed"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.Encode(v)
+}
+
+// runControlCommand talks to the control API of the "bee run" session
+// of the current directory.
+func runControlCommand(name string, args []string) int {
+	endpoint := "/" + name
+	if name == "logs" && len(args) > 0 {
+		endpoint += "?n=" + args[0]
+	}
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort("127.0.0.1", strconv.Itoa(config.Conf.Control.Port)), endpoint)
+
+	req, err := http.NewRequest(controlCommands[name], url, nil)
+	if err != nil {
+		beeLogger.Log.Fatalf("%s", err)
+	}
+	req.Header.Set(controlHeader, "1")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		beeLogger.Log.Fatalf("Cannot reach the control API: %s. Is 'bee run' running with -control?", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		beeLogger.Log.Fatalf("Failed to read the response of the control API: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// The errors of the API are a message, unless it is not the control API answering
+		var res controlResponse
+		if err := json.Unmarshal(body, &res); err != nil || res.Message == "" {
+			res.Message = strings.TrimSpace(string(body))
+		}
+		beeLogger.Log.Fatalf("Cannot %s (%s): %s", name, resp.Status, res.Message)
+	}
+
+	switch name {
+	case "status":
+		var status controlStatus
+		if err := json.Unmarshal(body, &status); err != nil {
+			beeLogger.Log.Fatalf("Invalid response of the control API: %s", err)
+		}
+		printStatus(status)
+	case "logs":
+		var logs struct{ Lines []string }
+		if err := json.Unmarshal(body, &logs); err != nil {
+			beeLogger.Log.Fatalf("Invalid response of the control API: %s", err)
+		}
+		for _, line := range logs.Lines {
+			fmt.Println(line)
+		}
+	default:
+		var res controlResponse
+		if err := json.Unmarshal(body, &res); err != nil {
+			beeLogger.Log.Fatalf("Invalid response of the control API: %s", err)
+		}
+		beeLogger.Log.Success(res.Message)
+	}
+	return 0
+}
+
+func printStatus(s controlStatus) {
+	w := os.Stdout
+	if s.App.Running {
+		fmt.Fprintf(w, "App:      %s (PID %d), up %s\n", s.App.Name, s.App.PID, time.Duration(s.App.Uptime)*time.Second)
+		if s.App.BuildHash != "" {
+			fmt.Fprintf(w, "Binary:   %s\n", s.App.BuildHash)
+		}
+	} else {
+		fmt.Fprintf(w, "App:      %s (not running)\n", s.App.Name)
+	}
+	for _, p := range s.Processes {
+		if p.Running {
+			fmt.Fprintf(w, "Process:  %s (PID %d)\n", p.Name, p.PID)
+		} else {
+			fmt.Fprintf(w, "Process:  %s (not running)\n", p.Name)
+		}
+	}
+	if b := s.LastBuild; b != nil {
+		fmt.Fprintf(w, "Build:    %s in %.0fms, at %s\n", b.Status, b.Duration, b.FinishedAt.Local().Format("15:04:05"))
+	} else {
+		fmt.Fprintln(w, "Build:    none yet")
+	}
+	state := "watching"
+	if s.Paused {
+		state = "paused"
+	}
+	fmt.Fprintf(w, "Watcher:  %s, %d directories\n", state, len(s.WatchedPaths))
+	for _, dir := range s.WatchedPaths {
+		fmt.Fprintf(w, "          %s\n", dir)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+)
+
+// Types of the events of the event stream
+const (
+	evWatch        = "watch"
+	evBuildStart   = "build-start"
+	evBuildFinish  = "build-finish"
+	evProcessStart = "process-start"
+	evProcessReady = "process-ready"
+	evProcessExit  = "process-exit"
+	evReload       = "reload"
+	evTestStart    = "test-start"
+	evTestFinish   = "test-finish"
+)
+
+// Results reported by the build-finish and test-finish events
+const (
+	statusOK        = "ok"
+	statusFailed    = "failed"
+	statusCancelled = "cancelled"
+)
+
+// event is an entry of the machine-readable event stream of "bee run".
+// Only the fields relevant to its type are set.
+type event struct {
+	Time        time.Time    `json:"time"`
+	Type        string       `json:"type"`
+	Op          string       `json:"op,omitempty"`           // Watch: the file operation, e.g. "WRITE".
+	Path        string       `json:"path,omitempty"`         // Watch and reload: the file, relative to the application.
+	Files       []string     `json:"files,omitempty"`        // Build start: the changed files.
+	Status      string       `json:"status,omitempty"`       // Build and test finish: "ok", "failed" or "cancelled".
+	Duration    float64      `json:"duration_ms,omitempty"`  // Build and test finish: the duration in milliseconds.
+	Diagnostics []buildError `json:"diagnostics,omitempty"`  // Build finish: the compiler errors.
+	Output      string       `json:"output,omitempty"`       // Build finish: the output of the failed step.
+	Process     string       `json:"process,omitempty"`      // Process: the name of the process, the application or another one.
+	PID         int          `json:"pid,omitempty"`          // Process: the process ID.
+	Port        int          `json:"port,omitempty"`         // Process ready: the HTTP port.
+	ExitCode    *int         `json:"exit_code,omitempty"`    // Process exit: the exit code, -1 if killed by a signal.
+	Signal      string       `json:"signal,omitempty"`       // Process exit: the signal which killed the process.
+	Stopped     bool         `json:"stopped,omitempty"`      // Process exit: the process was stopped by bee.
+	Message     string       `json:"message,omitempty"`      // Reload: the type of the message sent to the browsers.
+	Packages    []string     `json:"packages,omitempty"`     // Test start: the tested packages.
+	Passed      int          `json:"passed,omitempty"`       // Test finish: the number of passed tests.
+	Failed      int          `json:"failed,omitempty"`       // Test finish: the number of failed tests.
+	Skipped     int          `json:"skipped,omitempty"`      // Test finish: the number of skipped tests.
+	FailedTests []string     `json:"failed_tests,omitempty"` // Test finish: the failed tests and packages.
+}
+
+// eventStream writes the events as newline-delimited JSON to a file
+// or to the clients connected to a unix socket.
+type eventStream struct {
+	mu       sync.Mutex
+	out      io.Writer
+	listener net.Listener
+	conns    map[net.Conn]bool
+}
+
+var events *eventStream // nil unless the event stream is enabled
+
+// eventsToStdout reports whether the events are written to the standard output
+func eventsToStdout() bool {
+	return eventFormat != "" && (eventsOut == "" || eventsOut == "-")
+}
+
+// redirectOutput sends everything usually written to the standard output,
+// i.e. the logs and the output of the application, to the standard error,
+// keeping the standard output for the events. It returns the standard output.
+func redirectOutput() *os.File {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	beeLogger.Log.SetOutput(os.Stderr)
+	return stdout
+}
+
+// openEventStream opens the event stream: the standard output,
+// a file, or a unix socket if the destination starts with "unix:".
+func openEventStream(format string, dest string, stdout io.Writer) {
+	if format != "json" {
+		beeLogger.Log.Fatalf("Unsupported event format '%s', only 'json' is supported", format)
+	}
+
+	s := &eventStream{conns: make(map[net.Conn]bool)}
+	switch {
+	case dest == "" || dest == "-":
+		s.out = stdout
+	case strings.HasPrefix(dest, "unix:"):
+		sock := strings.TrimPrefix(dest, "unix:")
+		// Remove the socket left over by a previous run
+		os.Remove(sock)
+		l, err := net.Listen("unix", sock)
+		if err != nil {
+			beeLogger.Log.Fatalf("Failed to listen on the event socket: %s", err)
+		}
+		s.listener = l
+		go s.accept()
+		beeLogger.Log.Infof("Streaming events to %s", sock)
+	default:
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			beeLogger.Log.Fatalf("Failed to open the event file: %s", err)
+		}
+		s.out = f
+		beeLogger.Log.Infof("Writing events to %s", dest)
+	}
+	events = s
+}
+
+// closeEventStream removes the event socket, if any
+func closeEventStream() {
+	if events != nil && events.listener != nil {
+		events.listener.Close()
+	}
+}
+
+func (s *eventStream) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+	}
+}
+
+// emitEvent writes the event to the event stream, if enabled
+func emitEvent(e event) {
+	if events == nil {
+		return
+	}
+	e.Time = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		beeLogger.Log.Errorf("Failed to encode the event: %s", err)
+		return
+	}
+	data = append(data, '\n')
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if events.out != nil {
+		events.out.Write(data)
+	}
+	for conn := range events.conns {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if _, err := conn.Write(data); err != nil {
+			conn.Close()
+			delete(events.conns, conn)
+		}
+	}
+}
+
+// processExitEvent describes the exit of a process of the program
+func processExitEvent(prog *program, p *appProcess) event {
+	e := event{Type: evProcessExit, Process: prog.name, PID: p.cmd.Process.Pid, Stopped: p.stopped()}
+	code := 0
+	if p.cmd.ProcessState != nil {
+		if ws, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+			code = ws.ExitStatus()
+			if ws.Signaled() {
+				e.Signal = ws.Signal().String()
+			}
+		}
+	}
+	e.ExitCode = &code
+	return e
+}
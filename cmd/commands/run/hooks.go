@@ -0,0 +1,147 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/ClearGrass/qpbee/config"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+)
+
+// Stages of the build cycle at which hooks are run
+const (
+	hookPreBuild       = "pre_build"
+	hookPostBuild      = "post_build"
+	hookPreRestart     = "pre_restart"
+	hookOnBuildFailure = "on_build_failure"
+)
+
+// hookFiles matches the files some hooks are restricted to.
+// Changes to these files trigger a build cycle.
+var hookFiles *globMatcher
+
+// stageHooks returns the hooks configured for the stage
+func stageHooks(stage string) []config.Hook {
+	switch stage {
+	case hookPreBuild:
+		return config.Conf.Hooks.PreBuild
+	case hookPostBuild:
+		return config.Conf.Hooks.PostBuild
+	case hookPreRestart:
+		return config.Conf.Hooks.PreRestart
+	case hookOnBuildFailure:
+		return config.Conf.Hooks.OnBuildFailure
+	}
+	return nil
+}
+
+// loadHookFiles collects the file globs of all the hooks
+func loadHookFiles() {
+	hookFiles = newGlobMatcher(currpath, nil)
+	for _, stage := range []string{hookPreBuild, hookPostBuild, hookPreRestart, hookOnBuildFailure} {
+		for _, h := range stageHooks(stage) {
+			hookFiles.add(h.Files)
+		}
+	}
+}
+
+// runHooks runs the hooks of the stage in order and stops at the first one failing.
+// Hooks restricted to some files only run if one of the changed files matches,
+// or when no file has changed, e.g. on the first build or on a restart.
+func runHooks(ctx context.Context, stage string, changed []string) error {
+	for _, h := range stageHooks(stage) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !hookMatches(h, changed) {
+			continue
+		}
+		if err := runHook(ctx, stage, h, changed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookMatches reports whether the hook should run for the changed files
+func hookMatches(h config.Hook, changed []string) bool {
+	if len(h.Files) == 0 || len(changed) == 0 {
+		return true
+	}
+	m := newGlobMatcher(currpath, h.Files)
+	for _, name := range changed {
+		if m.Match(name, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// runHook runs the command of the hook, or the script it refers to, in the
+// application directory. The hook's stage and the changed files are passed
+// in the BEE_HOOK and BEE_CHANGED_FILES environment variables.
+func runHook(ctx context.Context, stage string, h config.Hook, changed []string) error {
+	name, command := h.Run, h.Run
+	if command == "" {
+		if h.Script == "" {
+			return fmt.Errorf("%s hook has neither a command nor a script", stage)
+		}
+		c, exist := config.Conf.Scripts[h.Script]
+		if !exist {
+			return fmt.Errorf("%s hook: script '%s' not found in Beefile/bee.json", stage, h.Script)
+		}
+		name, command = h.Script, c
+	}
+	beeLogger.Log.Infof("Running %s hook '%s'...", stage, name)
+
+	args := shellArgs(command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+
+	files := make([]string, 0, len(changed))
+	for _, name := range changed {
+		files = append(files, relPath(name))
+	}
+
+	var output bytes.Buffer
+	cmd.Dir = currpath
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+	cmd.Env = append(os.Environ(), "BEE_HOOK="+stage, "BEE_CHANGED_FILES="+strings.Join(files, " "))
+	if err := cmd.Run(); err != nil {
+		msg := fmt.Sprintf("%s hook '%s' failed: %s", stage, name, err)
+		if output.Len() > 0 {
+			msg += "\n" + output.String()
+		}
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// shellArgs returns the arguments running the command with the system shell
+func shellArgs(command string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", command}
+	}
+	return []string{"sh", "-c", command}
+}
@@ -0,0 +1,174 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	path "path/filepath"
+	"regexp"
+	"strings"
+)
+
+// globRule is a single gitignore-style pattern
+type globRule struct {
+	re      *regexp.Regexp
+	negate  bool // The pattern starts with "!" and re-includes matching paths.
+	dirOnly bool // The pattern ends with "/" and only matches directories.
+}
+
+// globMatcher matches paths relative to a base directory against
+// gitignore-style patterns. As in .gitignore, the last matching
+// pattern wins and everything below an excluded directory is excluded.
+type globMatcher struct {
+	base  string
+	rules []globRule
+}
+
+// newGlobMatcher compiles the given gitignore-style patterns
+func newGlobMatcher(base string, patterns []string) *globMatcher {
+	m := &globMatcher{base: base}
+	m.add(patterns)
+	return m
+}
+
+// addFile adds the patterns of a .gitignore-like file. Missing files are ignored.
+func (m *globMatcher) addFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	m.add(patterns)
+	return scanner.Err()
+}
+
+func (m *globMatcher) add(patterns []string) {
+	for _, p := range patterns {
+		p = strings.TrimRight(p, " \t\r")
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		var rule globRule
+		if strings.HasPrefix(p, "!") {
+			rule.negate = true
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			rule.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+		if p == "" {
+			continue
+		}
+
+		// Patterns with a slash are relative to the base directory,
+		// others match a file or directory name at any depth.
+		prefix := `(?:^|.*/)`
+		if strings.Contains(p, "/") {
+			prefix = `^`
+			p = strings.TrimPrefix(p, "/")
+		}
+		re, err := regexp.Compile(prefix + globToRegExp(p) + `$`)
+		if err != nil {
+			continue
+		}
+		rule.re = re
+		m.rules = append(m.rules, rule)
+	}
+}
+
+// Match reports whether the path is excluded by the patterns
+func (m *globMatcher) Match(p string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+
+	rel, err := path.Rel(m.base, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = path.ToSlash(rel)
+
+	// Everything below an excluded directory is excluded
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+func (m *globMatcher) match(rel string, isDir bool) bool {
+	matched := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(rel) {
+			matched = !rule.negate
+		}
+	}
+	return matched
+}
+
+// globToRegExp translates a glob, supporting "*", "?", "[...]" and "**", to a regular expression
+func globToRegExp(glob string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			buf.WriteString(`(?:.*/)?`)
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			buf.WriteString(`.*`)
+			i++
+		case c == '*':
+			buf.WriteString(`[^/]*`)
+		case c == '?':
+			buf.WriteString(`[^/]`)
+		case c == '[':
+			if j := strings.IndexByte(glob[i:], ']'); j > 0 {
+				class := glob[i+1 : i+j]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				buf.WriteString("[" + class + "]")
+				i += j
+				continue
+			}
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		case c == '\\' && i+1 < len(glob):
+			i++
+			buf.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// +build windows
+
+package run
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// setProcessGroup is a no-op on Windows, the process tree is
+// looked up by taskkill when the application is stopped.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup kills the process tree of the command since
+// Windows has no support for sending signals to other processes.
+func signalProcessGroup(cmd *exec.Cmd, name string) error {
+	return killProcessGroup(cmd)
+}
+
+// killProcessGroup forcibly kills the process tree of the command.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
@@ -0,0 +1,209 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// entryState is the state of a directory entry seen by the polling watcher
+type entryState struct {
+	isDir   bool
+	modTime time.Time
+	size    int64
+	hash    []byte // Content hash, only recomputed when the file looks modified.
+}
+
+// pollWatcher detects changes by periodically scanning the watched directories.
+// It is used where fsnotify delivers no events, such as Docker bind mounts or
+// NFS shares, and reports changes with the same events as fsnotify.Watcher.
+type pollWatcher struct {
+	Events chan fsnotify.Event
+	Errors chan error
+
+	interval time.Duration
+
+	mu   sync.Mutex
+	dirs map[string]map[string]*entryState // Entries of each watched directory.
+}
+
+// newPollWatcher starts a watcher scanning the watched directories at the given interval
+func newPollWatcher(interval time.Duration) *pollWatcher {
+	w := &pollWatcher{
+		Events:   make(chan fsnotify.Event),
+		Errors:   make(chan error),
+		interval: interval,
+		dirs:     make(map[string]map[string]*entryState),
+	}
+	go w.run()
+	return w
+}
+
+// Add starts watching the directory. Its current content is
+// recorded without reporting any event.
+func (w *pollWatcher) Add(name string) error {
+	entries, err := scanDir(name)
+	if err != nil {
+		return err
+	}
+	for filename, entry := range entries {
+		if !entry.isDir {
+			entry.hash = hashFile(path.Join(name, filename))
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.dirs[name]; !ok {
+		w.dirs[name] = entries
+	}
+	return nil
+}
+
+// Remove stops watching the directory
+func (w *pollWatcher) Remove(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.dirs, name)
+	return nil
+}
+
+func (w *pollWatcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, e := range w.poll() {
+			w.Events <- e
+		}
+	}
+}
+
+// poll scans the watched directories and returns the changes since the last scan
+func (w *pollWatcher) poll() []fsnotify.Event {
+	w.mu.Lock()
+	dirs := make([]string, 0, len(w.dirs))
+	for dir := range w.dirs {
+		dirs = append(dirs, dir)
+	}
+	w.mu.Unlock()
+
+	var events []fsnotify.Event
+	for _, dir := range dirs {
+		current, err := scanDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			go func(err error) { w.Errors <- err }(err)
+			continue
+		}
+
+		w.mu.Lock()
+		previous, ok := w.dirs[dir]
+		if !ok {
+			// Removed in the meantime
+			w.mu.Unlock()
+			continue
+		}
+		if current == nil {
+			// The directory is gone: report its files as removed
+			delete(w.dirs, dir)
+			current = map[string]*entryState{}
+		} else {
+			w.dirs[dir] = current
+		}
+		w.mu.Unlock()
+
+		events = append(events, diffEntries(dir, previous, current)...)
+	}
+	return events
+}
+
+// diffEntries compares two scans of a directory and returns the resulting events.
+// Files whose modification time or size changed are only reported as written
+// if their content actually changed.
+func diffEntries(dir string, previous, current map[string]*entryState) []fsnotify.Event {
+	var events []fsnotify.Event
+	for name, cur := range current {
+		filename := path.Join(dir, name)
+		prev, ok := previous[name]
+		if !cur.isDir {
+			if ok && !prev.isDir && cur.modTime.Equal(prev.modTime) && cur.size == prev.size {
+				cur.hash = prev.hash
+				continue
+			}
+			cur.hash = hashFile(filename)
+		}
+
+		if !ok {
+			events = append(events, fsnotify.Event{Name: filename, Op: fsnotify.Create})
+			continue
+		}
+		if cur.isDir || prev.isDir {
+			continue
+		}
+		if prev.hash != nil && bytes.Equal(prev.hash, cur.hash) {
+			continue
+		}
+		events = append(events, fsnotify.Event{Name: filename, Op: fsnotify.Write})
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			events = append(events, fsnotify.Event{Name: path.Join(dir, name), Op: fsnotify.Remove})
+		}
+	}
+	return events
+}
+
+// scanDir returns the state of the entries of the directory,
+// leaving the content hashes empty.
+func scanDir(dir string) (map[string]*entryState, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*entryState, len(fileInfos))
+	for _, fi := range fileInfos {
+		entries[fi.Name()] = &entryState{
+			isDir:   fi.IsDir(),
+			modTime: fi.ModTime(),
+			size:    fi.Size(),
+		}
+	}
+	return entries, nil
+}
+
+// hashFile returns the MD5 hash of the file content, or nil if it cannot be read
+func hashFile(filename string) []byte {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil
+	}
+	return h.Sum(nil)
+}
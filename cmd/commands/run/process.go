@@ -0,0 +1,248 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	path "path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ClearGrass/qpbee/config"
+)
+
+// appProcess is a started instance of the application
+type appProcess struct {
+	cmd      *exec.Cmd
+	done     chan struct{} // Closed once the process has exited.
+	err      error         // Result of cmd.Wait, valid once done is closed.
+	stopping int32         // Set when bee stops the process on purpose.
+}
+
+// startProcess starts the command in its own process group
+// and reaps it in the background.
+func startProcess(cmd *exec.Cmd) (*appProcess, error) {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &appProcess{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// exited reports whether the process has already exited
+func (p *appProcess) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop sends the stop signal to the process group and waits for the process
+// to exit. The group is killed if it is still running after the timeout.
+// It returns true if the process had to be killed.
+func (p *appProcess) stop(sig string, timeout time.Duration) (killed bool, err error) {
+	atomic.StoreInt32(&p.stopping, 1)
+	if p.exited() {
+		return false, nil
+	}
+
+	if err = signalProcessGroup(p.cmd, sig); err != nil {
+		killProcessGroup(p.cmd)
+		<-p.done
+		return true, err
+	}
+
+	select {
+	case <-p.done:
+		return false, nil
+	case <-time.After(timeout):
+		err = killProcessGroup(p.cmd)
+		<-p.done
+		return true, err
+	}
+}
+
+// stopped reports whether the process was stopped by bee,
+// as opposed to exiting on its own.
+func (p *appProcess) stopped() bool {
+	return atomic.LoadInt32(&p.stopping) == 1
+}
+
+// exitStatus describes how the process exited, e.g. "exit status 2" or "signal: killed"
+func (p *appProcess) exitStatus() string {
+	if p.err == nil {
+		return "exit status 0"
+	}
+	return p.err.Error()
+}
+
+// waitReady waits for the process to accept TCP connections on the given port.
+// It returns false if the process exits or the timeout expires first.
+func (p *appProcess) waitReady(port int, timeout time.Duration) bool {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if p.exited() {
+			return false
+		}
+		conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		select {
+		case <-p.done:
+			return false
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return false
+}
+
+// restartDelay returns the delay before the nth restart of a crashed
+// application: the configured delay doubled after each crash, up to a limit.
+func restartDelay(n int) time.Duration {
+	delay := time.Duration(config.Conf.Process.RestartDelay) * time.Second
+	max := time.Duration(config.Conf.Process.MaxRestartDelay) * time.Second
+	for i := 1; i < n && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// stopOnSignal stops the application when bee itself is interrupted: running in
+// its own process group, the application does not get the terminal's signals.
+func stopOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		Kill()
+		closeEventStream()
+		os.Exit(0)
+	}()
+}
+
+var (
+	iniSectionRegExp = regexp.MustCompile(`^\[\s*(.+?)\s*\]$`)
+	iniEnvRegExp     = regexp.MustCompile(`^\$\{(\w+)(?:\|\|(.*))?\}$`)
+)
+
+// appHTTPPort returns the port the application listens on. It is either set in
+// the bee configuration or read from the application's configuration file.
+// It returns 0 if the port cannot be determined.
+func appHTTPPort() int {
+	if config.Conf.Process.HTTPPort > 0 {
+		return config.Conf.Process.HTTPPort
+	}
+
+	for _, name := range appConfigFiles() {
+		if port, ok := readHTTPPort(path.Join(currpath, "conf", name)); ok {
+			return port
+		}
+	}
+	return 0
+}
+
+// appConfigFiles lists the candidate Beego configuration files, most specific first.
+// Applications generated by "bee api" pick theirs from ENV_CLUSTER.
+func appConfigFiles() []string {
+	var files []string
+	if env := os.Getenv("ENV_CLUSTER"); env != "" {
+		files = append(files, "app."+env+".conf")
+	}
+	return append(files, "app.conf", "app.dev.conf")
+}
+
+// readHTTPPort reads the httpport setting of a Beego INI configuration file,
+// honouring runmode sections and ${ENV||default} values. Beego listens on 8080
+// when the setting is missing.
+func readHTTPPort(filename string) (int, bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	var (
+		section string
+		values  = make(map[string]map[string]string)
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if m := iniSectionRegExp.FindStringSubmatch(line); m != nil {
+			section = strings.ToLower(m[1])
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if values[section] == nil {
+			values[section] = make(map[string]string)
+		}
+		values[section][strings.ToLower(strings.TrimSpace(kv[0]))] = expandINIValue(strings.TrimSpace(kv[1]))
+	}
+
+	mode := os.Getenv("BEEGO_RUNMODE")
+	if mode == "" {
+		mode = values[""]["runmode"]
+	}
+
+	value := values[""]["httpport"]
+	if v, ok := values[strings.ToLower(mode)]["httpport"]; ok {
+		value = v
+	}
+	if value == "" {
+		return 8080, true
+	}
+	port, err := strconv.Atoi(value)
+	return port, err == nil
+}
+
+// expandINIValue resolves Beego's ${ENV||default} syntax
+func expandINIValue(value string) string {
+	m := iniEnvRegExp.FindStringSubmatch(value)
+	if m == nil {
+		return strings.Trim(value, `"`)
+	}
+	if env := os.Getenv(m[1]); env != "" {
+		return env
+	}
+	return m[2]
+}
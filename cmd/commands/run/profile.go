@@ -0,0 +1,118 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"os"
+	path "path/filepath"
+	"strings"
+
+	"github.com/ClearGrass/qpbee/config"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+	"github.com/ClearGrass/qpbee/utils"
+)
+
+// applyProfile sets BEEGO_RUNMODE and ENV_CLUSTER to the profile name, loads the
+// .env and .env.<profile> files of the application, and applies the settings of
+// the profile on top of the main ones, its database as the BEE_DB_DRIVER and
+// BEE_DB_CONN variables of the application. Variables set in the environment before
+// bee was started win over the files, and .env.<profile> wins over .env.
+// A summary of what was injected is logged, hiding the secrets.
+func applyProfile(name string) {
+	original := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		original[strings.SplitN(kv, "=", 2)[0]] = true
+	}
+
+	beeLogger.Log.Infof("Using profile '%s'", name)
+	set := func(key, value, source string) {
+		os.Setenv(key, value)
+		beeLogger.Log.Infof("  %s=%s (%s)", key, utils.MaskSecret(key, value), source)
+	}
+
+	set("BEEGO_RUNMODE", name, "profile")
+	set("ENV_CLUSTER", name, "profile")
+
+	for _, file := range []string{".env", ".env." + name} {
+		vars, err := utils.ReadEnvFile(path.Join(currpath, file), os.Getenv)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			beeLogger.Log.Fatalf("Failed to read the environment file: %s", err)
+		}
+		for _, v := range vars {
+			if original[v.Name] {
+				beeLogger.Log.Infof("  %s kept from the environment, ignoring %s", v.Name, file)
+				continue
+			}
+			set(v.Name, v.Value, file)
+		}
+	}
+
+	p, ok := config.Conf.Profiles[name]
+	if !ok {
+		return
+	}
+	if len(p.CmdArgs) > 0 {
+		config.Conf.CmdArgs = p.CmdArgs
+		masked := make([]string, 0, len(p.CmdArgs))
+		for _, arg := range p.CmdArgs {
+			masked = append(masked, maskAssignment(arg))
+		}
+		beeLogger.Log.Infof("  cmd_args: %s", strings.Join(masked, " "))
+	}
+	// The database of the profile is given to the application through its environment,
+	// e.g. for "sqlconn = ${BEE_DB_CONN}" in its app.conf
+	envs := p.Envs
+	if p.Database.Driver != "" {
+		envs = mergeEnv(envs, []string{"BEE_DB_DRIVER=" + p.Database.Driver})
+	}
+	if p.Database.Conn != "" {
+		envs = mergeEnv(envs, []string{"BEE_DB_CONN=" + p.Database.Conn})
+	}
+	for _, env := range envs {
+		beeLogger.Log.Infof("  %s (envs)", maskAssignment(env))
+	}
+	config.Conf.Envs = mergeEnv(config.Conf.Envs, envs)
+}
+
+// maskAssignment hides the secret of a KEY=VALUE variable or a -flag=value argument
+func maskAssignment(s string) string {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return s
+	}
+	return kv[0] + "=" + utils.MaskSecret(kv[0], kv[1])
+}
+
+// mergeEnv adds the KEY=VALUE variables of extra to base,
+// replacing the variables of base with the same name
+func mergeEnv(base, extra []string) []string {
+	key := func(kv string) string {
+		return strings.SplitN(kv, "=", 2)[0]
+	}
+	overridden := make(map[string]bool, len(extra))
+	for _, kv := range extra {
+		overridden[key(kv)] = true
+	}
+	merged := make([]string, 0, len(base)+len(extra))
+	for _, kv := range base {
+		if !overridden[key(kv)] {
+			merged = append(merged, kv)
+		}
+	}
+	return append(merged, extra...)
+}
@@ -0,0 +1,315 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	path "path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/ClearGrass/qpbee/config"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+	"github.com/ClearGrass/qpbee/logger/colors"
+	"github.com/ClearGrass/qpbee/utils"
+)
+
+// program is a process supervised by "bee run": the application itself, or one
+// of the processes listed in the configuration file or in a Procfile.
+type program struct {
+	name    string
+	main    []string     // Main package directory or files, empty for the application's own directory.
+	command string       // Shell command run as is instead of a built binary.
+	args    []string     // Arguments of the binary.
+	envs    []string     // Extra environment variables.
+	watch   *globMatcher // Extra files rebuilding the program, nil if none.
+
+	stdout, stderr io.Writer
+
+	// Guarded by procMu
+	proc     *appProcess
+	restarts int // Restarts of the current build after a crash.
+}
+
+var (
+	app      *program   // The application.
+	programs []*program // The application first, then the other processes.
+
+	// programFiles matches the extra files of the processes.
+	// Changes to these files trigger a build cycle.
+	programFiles *globMatcher
+
+	procfileRegExp = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+	prefixColors   = []func(string) string{colors.Cyan, colors.Magenta, colors.Yellow, colors.Green, colors.Blue}
+)
+
+// loadPrograms sets up the application, built from the given main files,
+// and the processes of the configuration file or, if none, of the Procfile.
+// Once there are several processes, their output is prefixed with their name.
+func loadPrograms(files []string) {
+	app = &program{
+		name: appname,
+		main: files,
+		args: config.Conf.CmdArgs,
+		envs: config.Conf.Envs,
+	}
+	programs = []*program{app}
+	programFiles = newGlobMatcher(currpath, nil)
+
+	var (
+		procs  []*program
+		source = "Beefile/bee.json"
+	)
+	for _, e := range config.Conf.Processes {
+		p := &program{
+			name:    e.Name,
+			main:    e.Main,
+			command: e.Command,
+			args:    e.CmdArgs,
+			envs:    mergeEnv(config.Conf.Envs, e.Envs),
+		}
+		if len(e.Watch) > 0 {
+			p.watch = newGlobMatcher(currpath, e.Watch)
+			programFiles.add(e.Watch)
+		}
+		procs = append(procs, p)
+	}
+	if len(procs) == 0 {
+		var err error
+		source = "Procfile"
+		if procs, err = readProcfile(path.Join(currpath, "Procfile")); err != nil {
+			beeLogger.Log.Fatalf("Failed to read the Procfile: %s", err)
+		}
+	}
+
+	names := map[string]bool{appname: true}
+	for _, p := range procs {
+		switch {
+		case p.name == "":
+			beeLogger.Log.Fatalf("A process of the %s has no name", source)
+		case names[p.name]:
+			beeLogger.Log.Fatalf("Process '%s' of the %s is defined twice, or named after the application", p.name, source)
+		case len(p.main) == 0 && p.command == "":
+			beeLogger.Log.Fatalf("Process '%s' of the %s has neither main files nor a command", p.name, source)
+		}
+		names[p.name] = true
+		programs = append(programs, p)
+		beeLogger.Log.Infof("Supervising '%s' from the %s", p.name, source)
+	}
+
+	if len(programs) == 1 {
+		app.stdout = io.MultiWriter(os.Stdout, appOutput)
+		app.stderr = io.MultiWriter(os.Stderr, appOutput)
+		return
+	}
+
+	// Align the output of the processes
+	width := 0
+	for _, p := range programs {
+		if len(p.name) > width {
+			width = len(p.name)
+		}
+	}
+	var mu sync.Mutex
+	for i, p := range programs {
+		prefix := fmt.Sprintf("%-*s | ", width, p.name)
+		colored := prefixColors[i%len(prefixColors)](prefix)
+		logs := &prefixWriter{mu: &mu, out: appOutput, prefix: prefix}
+		p.stdout = io.MultiWriter(&prefixWriter{mu: &mu, out: os.Stdout, prefix: colored}, logs)
+		p.stderr = io.MultiWriter(&prefixWriter{mu: &mu, out: os.Stderr, prefix: colored}, logs)
+	}
+}
+
+// readProcfile reads the processes of a Procfile, made of "name: command" lines.
+// A command starting with a main package directory or a Go file of the
+// application is built and run with the rest of the command as arguments,
+// any other command is run as is. Entries running the application binary are
+// skipped, bee runs the application itself. A missing Procfile lists nothing.
+func readProcfile(filename string) ([]*program, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		procs []*program
+		n     = 0
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := procfileRegExp.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: expected 'name: command'", n)
+		}
+
+		p := &program{name: m[1], envs: config.Conf.Envs}
+		fields := strings.Fields(m[2])
+		switch {
+		case fields[0] == appname || fields[0] == "./"+appname || fields[0] == binaryName():
+			beeLogger.Log.Hintf("Skipping '%s' of the Procfile, the application is run by bee", p.name)
+			continue
+		case isGoMain(fields[0]):
+			p.main, p.args = fields[:1], fields[1:]
+		default:
+			p.command = m[2]
+		}
+		procs = append(procs, p)
+	}
+	return procs, scanner.Err()
+}
+
+// isGoMain reports whether the path, relative to the application,
+// is a Go file or a directory containing some
+func isGoMain(name string) bool {
+	full := path.Join(currpath, name)
+	if strings.HasSuffix(name, ".go") {
+		return utils.IsExist(full)
+	}
+	matches, _ := path.Glob(path.Join(full, "*.go"))
+	return len(matches) > 0
+}
+
+// binary returns the path of the program binary, in the build directory
+func (p *program) binary() string {
+	if p == app {
+		return path.Join(buildDir(), binaryName())
+	}
+	name := appname + "-" + p.name
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return path.Join(buildDir(), name)
+}
+
+// mainDir returns the directory of the main package of the program
+func (p *program) mainDir() string {
+	if len(p.main) == 0 {
+		return currpath
+	}
+	dir := path.Join(currpath, p.main[0])
+	if strings.HasSuffix(dir, ".go") {
+		dir = path.Dir(dir)
+	}
+	return dir
+}
+
+// affectedPrograms returns the programs to rebuild for the changed files.
+// A program is affected by the files of its main package and of the packages
+// it depends on, by the files matching its watch globs, and, unless it has
+// watch globs, by the files outside of any package, e.g. configuration files.
+// Programs running a command are only affected by their watch globs.
+// All the programs are affected if the packages cannot be listed.
+func affectedPrograms(ctx context.Context, changed []string) []*program {
+	pkgs, err := listPackages(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			beeLogger.Log.Warnf("Failed to list the packages, rebuilding all the processes: %s", err)
+		}
+		return programs
+	}
+	byDir := make(map[string]*goPackage, len(pkgs))
+	for _, pkg := range pkgs {
+		byDir[pkg.dir] = pkg
+	}
+
+	var affected []*program
+	for _, p := range programs {
+		if p.affectedBy(changed, byDir) {
+			affected = append(affected, p)
+		}
+	}
+	return affected
+}
+
+func (p *program) affectedBy(changed []string, byDir map[string]*goPackage) bool {
+	main, known := byDir[p.mainDir()]
+	for _, name := range changed {
+		if p.watch != nil && p.watch.Match(name, false) {
+			return true
+		}
+		if p.command != "" {
+			continue
+		}
+		pkg, ok := byDir[path.Dir(name)]
+		switch {
+		case !ok:
+			if p.watch == nil {
+				return true
+			}
+		case !known:
+			// The main package is unknown, e.g. it does not build
+			return true
+		case pkg == main || main.deps[pkg.importPath]:
+			return true
+		}
+	}
+	return false
+}
+
+// describePrograms returns the names of the programs
+func describePrograms(progs []*program) string {
+	names := make([]string, 0, len(progs))
+	for _, p := range progs {
+		names = append(names, "'"+p.name+"'")
+	}
+	return strings.Join(names, ", ")
+}
+
+// prefixWriter prefixes each line written by a process. Partial lines are
+// kept until completed, so that the lines of the processes are not mixed up.
+type prefixWriter struct {
+	mu      *sync.Mutex // Shared by the writers of all the processes.
+	out     io.Writer
+	prefix  string
+	partial []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := append(w.partial, p...)
+	var buf bytes.Buffer
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		buf.WriteString(w.prefix)
+		buf.Write(data[:i+1])
+		data = data[i+1:]
+	}
+	w.partial = append([]byte(nil), data...)
+	if _, err := w.out.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClearGrass/qpbee/config"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+)
+
+// Time a proxied request is held while the application is being rebuilt or restarted
+const proxyHoldTimeout = 2 * time.Minute
+
+// Path under which the proxy serves the live-reload client
+const proxyClientPath = "/_bee/reload.min.js"
+
+var (
+	gate *requestGate // Holds the proxied requests, nil if the proxy is disabled.
+
+	htmlHeadRegExp    = regexp.MustCompile(`(?i)<head(?:\s[^>]*)?>`)
+	htmlBodyEndRegExp = regexp.MustCompile(`(?i)</body\s*>`)
+)
+
+// requestGate holds the proxied requests while the application is being
+// rebuilt or restarted, and releases them once it is ready or the build failed.
+type requestGate struct {
+	mu      sync.Mutex
+	ready   chan struct{}  // Closed once requests can go through.
+	failure *reloadMessage // The failure of the latest build, if any.
+}
+
+// holdRequests holds the proxied requests until releaseRequests is called
+func holdRequests() {
+	if gate == nil {
+		return
+	}
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	select {
+	case <-gate.ready:
+		gate.ready = make(chan struct{})
+	default:
+	}
+	gate.failure = nil
+}
+
+// releaseRequests lets the held requests through. If the build failed,
+// they are answered with the build errors instead of being forwarded.
+func releaseRequests(failure *reloadMessage) {
+	if gate == nil {
+		return
+	}
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	gate.failure = failure
+	select {
+	case <-gate.ready:
+	default:
+		close(gate.ready)
+	}
+}
+
+// wait waits for the requests to be released. It returns false on timeout.
+func (g *requestGate) wait(timeout time.Duration) (*reloadMessage, bool) {
+	g.mu.Lock()
+	ready := g.ready
+	g.mu.Unlock()
+
+	select {
+	case <-ready:
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.failure, true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
+// proxyTransport forwards the requests to the application once it is ready
+// and injects the live-reload client into the HTML pages.
+type proxyTransport struct {
+	gate *requestGate
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline := time.Now().Add(proxyHoldTimeout)
+	for {
+		failure, ok := t.gate.wait(deadline.Sub(time.Now()))
+		if !ok {
+			return proxyResponse(req, http.StatusGatewayTimeout, "text/plain; charset=utf-8",
+				fmt.Sprintf("'%s' did not become ready within %s\n", appname, proxyHoldTimeout)), nil
+		}
+		if failure != nil {
+			return injectReloadClient(buildFailedResponse(req, failure))
+		}
+
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err == nil {
+			return injectReloadClient(resp)
+		}
+
+		// The application may be restarting: retry requests without a body
+		// until it accepts connections again.
+		if opErr, ok := err.(*net.OpError); !ok || opErr.Op != "dial" || req.ContentLength != 0 || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// startProxy starts the live-reload proxy in front of the application
+func startProxy() {
+	appPort := appHTTPPort()
+	if appPort == 0 {
+		beeLogger.Log.Fatal("Cannot determine the application's HTTP port for the live-reload proxy, please set 'process.http_port'")
+	}
+	if appPort == config.Conf.Reload.ProxyPort {
+		beeLogger.Log.Fatalf("The live-reload proxy cannot listen on the application's port %d", appPort)
+	}
+
+	// Requests are held until the application first becomes ready
+	gate = &requestGate{ready: make(chan struct{})}
+
+	target := &url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(appPort))}
+	rp := httputil.NewSingleHostReverseProxy(target)
+	director := rp.Director
+	rp.Director = func(req *http.Request) {
+		director(req)
+		// Get uncompressed pages to be able to inject the client
+		req.Header.Del("Accept-Encoding")
+	}
+	rp.Transport = &proxyTransport{gate: gate}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(proxyClientPath, serveReloadClient)
+	mux.Handle("/", rp)
+
+	addr := fmt.Sprintf(":%d", config.Conf.Reload.ProxyPort)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			beeLogger.Log.Errorf("Failed to start up the live-reload proxy: %v", err)
+		}
+	}()
+	beeLogger.Log.Infof("Live-reload proxy listening at %s, forwarding to port %d", addr, appPort)
+}
+
+// injectReloadClient adds the live-reload client to HTML responses
+func injectReloadClient(resp *http.Response) (*http.Response, error) {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") ||
+		resp.Header.Get("Content-Encoding") != "" ||
+		(resp.Request != nil && resp.Request.Method == "HEAD") {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	body = insertReloadScript(body)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return resp, nil
+}
+
+// insertReloadScript inserts the script tags loading the live-reload client at the
+// top of the head, so that it takes precedence over a reload.min.js already included
+// by the page. Pages without head get the scripts at the end of the body.
+func insertReloadScript(body []byte) []byte {
+	script := fmt.Sprintf(`<script>window.beeReloadURL="ws://"+location.hostname+":%d/reload"</script><script src="%s"></script>`,
+		config.Conf.Reload.Port, proxyClientPath)
+
+	if loc := htmlHeadRegExp.FindIndex(body); loc != nil {
+		return insertAt(body, loc[1], script)
+	}
+	if locs := htmlBodyEndRegExp.FindAllIndex(body, -1); locs != nil {
+		return insertAt(body, locs[len(locs)-1][0], script)
+	}
+	return append(body, script...)
+}
+
+func insertAt(body []byte, i int, s string) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(body) + len(s))
+	buf.Write(body[:i])
+	buf.WriteString(s)
+	buf.Write(body[i:])
+	return buf.Bytes()
+}
+
+// buildFailedResponse answers a request held while the application failed to build
+func buildFailedResponse(req *http.Request, failure *reloadMessage) *http.Response {
+	body := fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Build failed</title>\n</head>\n<body>\n<h1>Build failed</h1>\n<pre>%s</pre>\n</body>\n</html>\n",
+		html.EscapeString(failure.Output))
+	return proxyResponse(req, http.StatusBadGateway, "text/html; charset=utf-8", body)
+}
+
+// proxyResponse returns a response generated by the proxy itself
+func proxyResponse(req *http.Request, status int, contentType string, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -14,11 +14,19 @@
 package run
 
 import (
-	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/ClearGrass/qpbee/config"
 	beeLogger "github.com/ClearGrass/qpbee/logger"
+	"github.com/ClearGrass/qpbee/reload"
 	"github.com/gorilla/websocket"
 )
 
@@ -101,20 +109,8 @@ func (c *wsClient) writePump() {
 				return
 			}
 
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte("/n"))
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			// Each JSON message goes in its own frame
+			if err := c.write(websocket.TextMessage, message); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -126,8 +122,13 @@ func (c *wsClient) writePump() {
 }
 
 var (
-	broker        *wsBroker  // The broker.
-	reloadAddress = ":12450" // The port on which the reload server will listen to.
+	broker        *wsBroker // The broker.
+	reloadAddress string    // The address on which the reload server will listen to.
+
+	lastFailure   []byte // The build-failed message of the current build, if any.
+	lastFailureMu sync.Mutex
+
+	buildErrorRegExp = regexp.MustCompile(`^(.+\.go):(\d+)(?::(\d+))?: (.+)$`)
 
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
@@ -143,6 +144,7 @@ const (
 )
 
 func startReloadServer() {
+	reloadAddress = fmt.Sprintf(":%d", config.Conf.Reload.Port)
 	broker = &wsBroker{
 		broadcast:  make(chan []byte),
 		register:   make(chan *wsClient),
@@ -154,6 +156,7 @@ func startReloadServer() {
 	http.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
 		handleWsRequest(broker, w, r)
 	})
+	http.HandleFunc("/reload.min.js", serveReloadClient)
 
 	go startServer()
 	beeLogger.Log.Infof("Reload server listening at %s", reloadAddress)
@@ -167,9 +170,84 @@ func startServer() {
 	}
 }
 
-func sendReload(payload string) {
-	message := bytes.TrimSpace([]byte(payload))
-	broker.broadcast <- message
+// Types of the messages sent to the browser
+const (
+	msgBuildStarted = "build-started"
+	msgBuildFailed  = "build-failed"
+	msgBuildOK      = "build-ok"
+	msgCSSChanged   = "css-changed"
+	msgReload       = "reload"
+)
+
+// reloadMessage is a message of the live-reload protocol, sent as JSON to the browser
+type reloadMessage struct {
+	Type   string       `json:"type"`
+	Path   string       `json:"path,omitempty"`   // Changed file, relative to the application.
+	Files  []string     `json:"files,omitempty"`  // Files which triggered the build.
+	Errors []buildError `json:"errors,omitempty"` // Compiler errors of a failed build.
+	Output string       `json:"output,omitempty"` // Raw output of a failed build.
+}
+
+// buildError is a compiler error reported at a position in a source file
+type buildError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// parseBuildErrors extracts the file:line[:column] errors from the output of "go build"
+func parseBuildErrors(output string) []buildError {
+	var errs []buildError
+	for _, line := range strings.Split(output, "\n") {
+		m := buildErrorRegExp.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		e := buildError{File: strings.TrimPrefix(m[1], "./"), Message: m[4]}
+		e.Line, _ = strconv.Atoi(m[2])
+		e.Column, _ = strconv.Atoi(m[3])
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// sendReloadMessage broadcasts the message to the connected browsers.
+// The latest build failure is remembered and sent to pages loaded
+// afterwards, until a build succeeds.
+func sendReloadMessage(msg reloadMessage) {
+	if broker == nil {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		beeLogger.Log.Errorf("Failed to encode the reload message: %s", err)
+		return
+	}
+
+	lastFailureMu.Lock()
+	switch msg.Type {
+	case msgBuildFailed:
+		lastFailure = data
+	case msgBuildOK:
+		lastFailure = nil
+	}
+	lastFailureMu.Unlock()
+
+	broker.broadcast <- data
+	emitEvent(event{Type: evReload, Message: msg.Type, Path: msg.Path})
+}
+
+// sendReload asks the browsers to reload the page
+func sendReload(path string) {
+	sendReloadMessage(reloadMessage{Type: msgReload, Path: path})
+}
+
+// serveReloadClient serves the live-reload browser client
+func serveReloadClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	io.WriteString(w, reload.Client(config.Conf.Reload.Port))
 }
 
 // handleWsRequest handles websocket requests from the peer.
@@ -187,6 +265,12 @@ func handleWsRequest(broker *wsBroker, w http.ResponseWriter, r *http.Request) {
 	}
 	client.broker.register <- client
 
+	lastFailureMu.Lock()
+	if lastFailure != nil {
+		client.send <- lastFailure
+	}
+	lastFailureMu.Unlock()
+
 	go client.writePump()
 	client.readPump()
 }
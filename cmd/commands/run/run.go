@@ -14,11 +14,13 @@
 package run
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	path "path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/ClearGrass/qpbee/cmd/commands"
 	"github.com/ClearGrass/qpbee/cmd/commands/version"
@@ -28,14 +30,42 @@ import (
 )
 
 var CmdRun = &commands.Command{
-	UsageLine: "run [appname] [watchall] [-main=*.go] [-downdoc=true]  [-gendoc=true] [-vendor=true] [-e=folderToExclude] [-ex=extraPackageToWatch] [-tags=goBuildTags] [-runmode=BEEGO_RUNMODE]",
+	UsageLine: "run [appname] [watchall] [-main=*.go] [-downdoc=true]  [-gendoc=true] [-vendor=true] [-e=folderToExclude] [-ex=extraPackageToWatch] [-tags=goBuildTags] [-runmode=BEEGO_RUNMODE] [-profile=name] [-poll=interval] [-proxy=port] [-reloadport=port] [-events=json] [-eventsout=file|unix:socket] [-test] [-testonly] [-control [status|logs|rebuild|restart|pause|resume]] [-ldflags=flags] [-gcflags=flags] [-mod=mode] [-race] [-cover] [-buildenv=KEY=VALUE] [-output=dir]",
 	Short:     "Run the application by starting a local development server",
 	Long: `
 Run command will supervise the filesystem of the application for any changes, and recompile/restart it.
 
+With -profile=name, BEEGO_RUNMODE and ENV_CLUSTER are set to the profile name, the variables of
+the .env and .env.<name> files are loaded, and the settings of the profile in Beefile/bee.json
+(cmd_args, envs and database) are applied. The database of the profile is passed to the application
+as the BEE_DB_DRIVER and BEE_DB_CONN variables. Variables already set in the environment are kept.
+
+Other processes, e.g. workers, can be supervised along with the application: list them under
+"processes" in Beefile/bee.json, or in a Procfile of "name: command" lines. Their output is
+prefixed with their name, and only the processes depending on the changed packages are rebuilt.
+
+The binaries are built into a temporary directory, or the "output" of the build settings in
+Beefile/bee.json, which also set the tags, ldflags, gcflags, module mode and environment of
+"go build". With -race or -cover, the application is built with the race detector or with
+coverage instrumentation, its coverage data being written to the "cover_dir".
+
+With -control, a running session can be driven from another terminal of the application directory:
+
+  {{"$ bee run -control status" | bold}}      Show the application PID and uptime, the last build and the watched paths
+  {{"$ bee run -control logs [N]" | bold}}    Print the last N lines of the application output
+  {{"$ bee run -control rebuild" | bold}}     Rebuild and restart the application
+  {{"$ bee run -control restart" | bold}}     Restart the application
+  {{"$ bee run -control pause" | bold}}       Ignore changes, e.g. during a rebase
+  {{"$ bee run -control resume" | bold}}      Watch changes again, rebuilding if some were missed
 `,
-	PreRun: func(cmd *commands.Command, args []string) { version.ShowShortVersionBanner() },
-	Run:    RunApp,
+	PreRun: func(cmd *commands.Command, args []string) {
+		// Keep the standard output for the events
+		if eventsToStdout() {
+			eventsStdout = redirectOutput()
+		}
+		version.ShowShortVersionBanner()
+	},
+	Run: RunApp,
 }
 
 var (
@@ -56,12 +86,41 @@ var (
 	vendorWatch bool
 	// Current user workspace
 	currentGoPath string
+	// Indicates whether the application is a Go module
+	moduleMode bool
 	// Current runmode
 	runmode string
+	// Runmode profile
+	profile string
 	// Extra directories
 	extraPackages utils.StrFlags
+	// Interval of the polling watcher, fsnotify is used if not set
+	pollInterval time.Duration
+	// Port of the live-reload proxy
+	proxyPort int
+	// Port of the live-reload server
+	reloadPort int
+	// Format of the event stream, disabled if not set
+	eventFormat string
+	// Destination of the event stream
+	eventsOut string
+	// Standard output kept for the event stream
+	eventsStdout io.Writer = os.Stdout
+	// Run the tests affected by the changes along with the rebuilds
+	testMode bool
+	// Only run the tests, without building and running the application
+	testOnly bool
+	// Enable the control API
+	controlAPI bool
+	// Flags of "go build", overriding the build section of the configuration file
+	ldflags     string
+	gcflags     string
+	modFlag     string
+	raceBuild   bool
+	coverBuild  bool
+	buildEnvs   utils.StrFlags
+	buildOutput string
 )
-var started = make(chan bool)
 
 func init() {
 	CmdRun.Flag.Var(&mainFiles, "main", "Specify main go files.")
@@ -71,23 +130,55 @@ func init() {
 	CmdRun.Flag.BoolVar(&vendorWatch, "vendor", false, "Enable watch vendor folder.")
 	CmdRun.Flag.StringVar(&buildTags, "tags", "", "Set the build tags. See: https://golang.org/pkg/go/build/")
 	CmdRun.Flag.StringVar(&runmode, "runmode", "", "Set the Beego run mode.")
+	CmdRun.Flag.StringVar(&profile, "profile", "", "Run with a profile: set the runmode and ENV_CLUSTER, load .env and .env.<profile>, and apply the profile settings.")
 	CmdRun.Flag.Var(&extraPackages, "ex", "List of extra package to watch.")
+	CmdRun.Flag.DurationVar(&pollInterval, "poll", 0, "Poll for changes at the given interval (e.g. 1s) instead of relying on filesystem events.")
+	CmdRun.Flag.IntVar(&proxyPort, "proxy", 0, "Start a live-reload proxy in front of the application on the given port.")
+	CmdRun.Flag.IntVar(&reloadPort, "reloadport", 0, "Set the port of the live-reload server.")
+	CmdRun.Flag.StringVar(&eventFormat, "events", "", "Emit machine-readable events in the given format (json).")
+	CmdRun.Flag.StringVar(&eventsOut, "eventsout", "", "Write the events to a file or to a unix socket (unix:path) instead of the standard output.")
+	CmdRun.Flag.BoolVar(&testMode, "test", false, "Run the tests of the packages affected by the changes, along with rebuilding the application.")
+	CmdRun.Flag.BoolVar(&testOnly, "testonly", false, "Run the tests of the packages affected by the changes instead of rebuilding the application.")
+	CmdRun.Flag.BoolVar(&controlAPI, "control", false, "Enable the control API, or talk to it with 'bee run -control status|logs|rebuild|restart|pause|resume'.")
+	CmdRun.Flag.StringVar(&ldflags, "ldflags", "", "Set the -ldflags of 'go build', environment variables are expanded.")
+	CmdRun.Flag.StringVar(&gcflags, "gcflags", "", "Set the -gcflags of 'go build'.")
+	CmdRun.Flag.StringVar(&modFlag, "mod", "", "Set the module download mode of 'go build', e.g. vendor.")
+	CmdRun.Flag.BoolVar(&raceBuild, "race", false, "Build the application with the race detector.")
+	CmdRun.Flag.BoolVar(&coverBuild, "cover", false, "Build a coverage-instrumented application, writing its coverage data to the cover_dir of the build settings.")
+	CmdRun.Flag.Var(&buildEnvs, "buildenv", "Set an environment variable of 'go build', e.g. CGO_ENABLED=0.")
+	CmdRun.Flag.StringVar(&buildOutput, "output", "", "Set the directory of the binaries, a temporary directory by default.")
 	exit = make(chan bool)
 	commands.AvailableCommands = append(commands.AvailableCommands, CmdRun)
 }
 
 func RunApp(cmd *commands.Command, args []string) int {
+	if controlAPI && len(args) > 0 {
+		if _, ok := controlCommands[args[0]]; ok {
+			return runControlCommand(args[0], args[1:])
+		}
+	}
+
 	if len(args) == 0 || args[0] == "watchall" {
 		currpath, _ = os.Getwd()
-		if found, _gopath, _ := utils.SearchGOPATHs(currpath); found {
+		if found, _, _ := utils.SearchGoMod(currpath); found {
+			appname = path.Base(currpath)
+			currentGoPath = defaultGoPath()
+			moduleMode = true
+		} else if found, _gopath, _ := utils.SearchGOPATHs(currpath); found {
 			appname = path.Base(currpath)
 			currentGoPath = _gopath
 		} else {
 			beeLogger.Log.Fatalf("No application '%s' found in your GOPATH", currpath)
 		}
 	} else {
-		// Check if passed Bee application path/name exists in the GOPATH(s)
-		if found, _gopath, _path := utils.SearchGOPATHs(args[0]); found {
+		// Check if passed Bee application path is inside a Go module,
+		// otherwise look for it in the GOPATH(s)
+		if found, _path := searchModuleApp(args[0]); found {
+			currpath = _path
+			currentGoPath = defaultGoPath()
+			appname = path.Base(currpath)
+			moduleMode = true
+		} else if found, _gopath, _path := utils.SearchGOPATHs(args[0]); found {
 			currpath = _path
 			currentGoPath = _gopath
 			appname = path.Base(currpath)
@@ -108,6 +199,10 @@ func RunApp(cmd *commands.Command, args []string) int {
 
 	beeLogger.Log.Debugf("Current path: %s", utils.FILE(), utils.LINE(), currpath)
 
+	if profile != "" {
+		applyProfile(profile)
+	}
+
 	if runmode == "prod" || runmode == "dev" {
 		os.Setenv("BEEGO_RUNMODE", runmode)
 		beeLogger.Log.Infof("Using '%s' as 'runmode'", os.Getenv("BEEGO_RUNMODE"))
@@ -118,6 +213,36 @@ func RunApp(cmd *commands.Command, args []string) int {
 		beeLogger.Log.Warnf("Using '%s' as 'runmode'", os.Getenv("BEEGO_RUNMODE"))
 	}
 
+	loadWatchSettings()
+	loadBuildSettings()
+
+	if pollInterval == 0 && config.Conf.WatchPoll != "" {
+		d, err := time.ParseDuration(config.Conf.WatchPoll)
+		if err != nil {
+			beeLogger.Log.Fatalf("Invalid watch_poll interval '%s': %s", config.Conf.WatchPoll, err)
+		}
+		pollInterval = d
+	}
+
+	if proxyPort > 0 {
+		config.Conf.Reload.ProxyPort = proxyPort
+	}
+	if reloadPort > 0 {
+		config.Conf.Reload.Port = reloadPort
+	}
+	// The proxy exists to provide live reload
+	if config.Conf.Reload.ProxyPort > 0 {
+		config.Conf.EnableReload = true
+	}
+
+	files := []string{}
+	for _, arg := range mainFiles {
+		if len(arg) > 0 {
+			files = append(files, arg)
+		}
+	}
+	loadPrograms(files)
+
 	var paths []string
 	readAppDirectories(currpath, &paths)
 
@@ -130,6 +255,12 @@ func RunApp(cmd *commands.Command, args []string) int {
 	if len(extraPackages) > 0 {
 		// get the full path
 		for _, packagePath := range extraPackages {
+			if moduleMode {
+				if _fullPath, err := utils.GoListDir(packagePath); err == nil {
+					readAppDirectories(_fullPath, &paths)
+					continue
+				}
+			}
 			if found, _, _fullPath := utils.SearchGOPATHs(packagePath); found {
 				readAppDirectories(_fullPath, &paths)
 			} else {
@@ -149,12 +280,6 @@ func RunApp(cmd *commands.Command, args []string) int {
 		}
 	}
 
-	files := []string{}
-	for _, arg := range mainFiles {
-		if len(arg) > 0 {
-			files = append(files, arg)
-		}
-	}
 	if downdoc == "true" {
 		if _, err := os.Stat(path.Join(currpath, "swagger", "index.html")); err != nil {
 			if os.IsNotExist(err) {
@@ -164,10 +289,23 @@ func RunApp(cmd *commands.Command, args []string) int {
 		}
 	}
 
+	if eventFormat != "" {
+		openEventStream(eventFormat, eventsOut, eventsStdout)
+	}
+
+	// Stop the application along with bee
+	stopOnSignal()
+
 	// Start the Reload server (if enabled)
 	if config.Conf.EnableReload {
 		startReloadServer()
 	}
+	if config.Conf.Reload.ProxyPort > 0 {
+		startProxy()
+	}
+	if controlAPI || config.Conf.Control.Enable {
+		startControlServer()
+	}
 	if gendoc == "true" {
 		NewWatcher(paths, files, true)
 		AutoBuild(files, true)
@@ -182,43 +320,62 @@ func RunApp(cmd *commands.Command, args []string) int {
 	}
 }
 
+// readAppDirectories adds the directory and its sub-directories of the watched tree to paths.
+// They are all watched, even without any file to watch yet, so that the packages created
+// in them are noticed; the files are filtered by their events.
 func readAppDirectories(directory string, paths *[]string) {
 	fileInfos, err := ioutil.ReadDir(directory)
 	if err != nil {
 		return
 	}
 
-	useDirectory := false
+	*paths = append(*paths, directory)
 	for _, fileInfo := range fileInfos {
-		if strings.HasSuffix(fileInfo.Name(), "docs") {
-			continue
-		}
-		if strings.HasSuffix(fileInfo.Name(), "swagger") {
-			continue
-		}
-
-		if !vendorWatch && strings.HasSuffix(fileInfo.Name(), "vendor") {
-			continue
-		}
-
-		if isExcluded(path.Join(directory, fileInfo.Name())) {
-			continue
+		fullPath := path.Join(directory, fileInfo.Name())
+		if fileInfo.IsDir() && shouldWatchDir(fullPath) {
+			readAppDirectories(fullPath, paths)
 		}
+	}
+}
 
-		if fileInfo.IsDir() && fileInfo.Name()[0] != '.' {
-			readAppDirectories(directory+"/"+fileInfo.Name(), paths)
-			continue
-		}
+// shouldWatchDir returns true if the directory belongs to the watched tree of the application
+func shouldWatchDir(dir string) bool {
+	name := path.Base(dir)
+	if name[0] == '.' {
+		return false
+	}
+	if strings.HasSuffix(name, "docs") || strings.HasSuffix(name, "swagger") {
+		return false
+	}
+	if !vendorWatch && strings.HasSuffix(name, "vendor") {
+		return false
+	}
+	if isExcluded(dir) {
+		return false
+	}
+	return !excludedGlobs.Match(dir, true)
+}
 
-		if useDirectory {
-			continue
-		}
+// searchModuleApp checks whether the given application path exists
+// and belongs to a Go module. It returns a boolean and the application's full path.
+func searchModuleApp(app string) (bool, string) {
+	fullPath, err := path.Abs(app)
+	if err != nil || !utils.IsExist(fullPath) {
+		return false, ""
+	}
+	if found, _, _ := utils.SearchGoMod(fullPath); found {
+		return true, fullPath
+	}
+	return false, ""
+}
 
-		if path.Ext(fileInfo.Name()) == ".go" || (ifStaticFile(fileInfo.Name()) && config.Conf.EnableReload) {
-			*paths = append(*paths, directory)
-			useDirectory = true
-		}
+// defaultGoPath returns the first GOPATH entry (used to expand $GOPATH in
+// the watched directories) for applications built in module mode.
+func defaultGoPath() string {
+	if gps := utils.GetGOPATHs(); len(gps) > 0 {
+		return gps[0]
 	}
+	return ""
 }
 
 // If a file is excluded
@@ -0,0 +1,163 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// buildFunc builds the application. The context is cancelled as soon as newer
+// changes are scheduled, and changed holds the files that triggered the build.
+type buildFunc func(ctx context.Context, changed []string)
+
+// buildScheduler coalesces bursts of file events into a single build.
+// A build only starts once no new change has been scheduled for the
+// configured delay, builds never overlap, and an in-progress build is
+// cancelled whenever a newer change is scheduled.
+type buildScheduler struct {
+	delay   time.Duration
+	build   buildFunc
+	modTime func(name string) int64
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	pending  map[string]struct{} // Files changed since the last build started.
+	modTimes map[string]int64    // Last seen modification time of each file.
+	cancel   context.CancelFunc  // Cancels the latest build.
+	done     chan struct{}       // Closed when the latest build returns.
+}
+
+// newBuildScheduler returns a scheduler that calls build once changes
+// have settled for the given delay.
+func newBuildScheduler(delay time.Duration, build buildFunc) *buildScheduler {
+	return &buildScheduler{
+		delay:    delay,
+		build:    build,
+		modTime:  fileModTime,
+		pending:  make(map[string]struct{}),
+		modTimes: make(map[string]int64),
+	}
+}
+
+// Schedule records a change of the named file and (re)arms the debounce timer.
+// Any build in progress is cancelled. It returns false if the file has not been
+// modified since it was last scheduled, in which case the event is dropped.
+func (s *buildScheduler) Schedule(name string) bool {
+	mt := s.modTime(name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.modTimes[name]; ok && t == mt {
+		return false
+	}
+	s.modTimes[name] = mt
+	s.pending[name] = struct{}{}
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.delay, func() { s.run(false) })
+	} else {
+		s.timer.Reset(s.delay)
+	}
+	return true
+}
+
+// Trigger starts a build right away, without waiting for any file change.
+// It blocks until the build returns.
+func (s *buildScheduler) Trigger() {
+	s.run(true)
+}
+
+// run starts a build for the pending changes once the previous build has
+// returned. Unless force is set, nothing happens when no change is pending.
+func (s *buildScheduler) run(force bool) {
+	s.mu.Lock()
+	if !force && len(s.pending) == 0 {
+		s.mu.Unlock()
+		return
+	}
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	prev, done := s.done, make(chan struct{})
+	s.cancel, s.done = cancel, done
+	s.mu.Unlock()
+
+	defer close(done)
+	defer cancel()
+
+	// Builds never overlap: wait for the (cancelled) previous one to return.
+	if prev != nil {
+		<-prev
+	}
+
+	changed := s.takePending()
+	if ctx.Err() == nil {
+		s.build(ctx, changed)
+	}
+	if ctx.Err() != nil {
+		// Superseded by newer changes: make sure these files are reported
+		// by the build that replaces this one.
+		s.requeue(changed)
+	}
+}
+
+// takePending returns the sorted list of pending files and clears it.
+func (s *buildScheduler) takePending() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := make([]string, 0, len(s.pending))
+	for name := range s.pending {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	s.pending = make(map[string]struct{})
+	return changed
+}
+
+// requeue marks files of a cancelled build as pending again.
+func (s *buildScheduler) requeue(changed []string) {
+	if len(changed) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range changed {
+		s.pending[name] = struct{}{}
+	}
+	s.timer.Reset(s.delay)
+}
+
+// fileModTime returns the modification time of the named file in nanoseconds.
+// Removed or unreadable files always report a new time so that they are rebuilt.
+func fileModTime(name string) int64 {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return time.Now().UnixNano()
+	}
+	return fi.ModTime().UnixNano()
+}
@@ -0,0 +1,187 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testDelay = 20 * time.Millisecond
+
+// fakeBuilds records the builds of a scheduler. The first blocked builds only
+// return once their context is cancelled.
+type fakeBuilds struct {
+	mu        sync.Mutex
+	files     map[string]int64 // Modification time of each file.
+	builds    [][]string
+	cancelled []bool
+	running   int
+	overlap   bool
+	blocked   int
+}
+
+func (f *fakeBuilds) build(ctx context.Context, changed []string) {
+	f.mu.Lock()
+	f.running++
+	if f.running > 1 {
+		f.overlap = true
+	}
+	f.builds = append(f.builds, changed)
+	block := f.blocked > 0
+	if block {
+		f.blocked--
+	}
+	f.mu.Unlock()
+
+	if block {
+		<-ctx.Done()
+	}
+
+	f.mu.Lock()
+	f.running--
+	f.cancelled = append(f.cancelled, ctx.Err() != nil)
+	f.mu.Unlock()
+}
+
+func (f *fakeBuilds) modTime(name string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.files[name]
+}
+
+// touch changes the modification time of the named file.
+func (f *fakeBuilds) touch(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[name]++
+}
+
+// started returns the number of builds started so far.
+func (f *fakeBuilds) started() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.builds)
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBuildScheduler(t *testing.T) {
+	tests := []struct {
+		name          string
+		blocked       int // Number of builds that wait for their cancellation.
+		run           func(t *testing.T, s *buildScheduler, f *fakeBuilds)
+		wantBuilds    [][]string
+		wantCancelled []bool
+	}{
+		{
+			name: "burst is built once",
+			run: func(t *testing.T, s *buildScheduler, f *fakeBuilds) {
+				for _, name := range []string{"c.go", "a.go", "b.go", "a.go"} {
+					f.touch(name)
+					s.Schedule(name)
+				}
+			},
+			wantBuilds:    [][]string{{"a.go", "b.go", "c.go"}},
+			wantCancelled: []bool{false},
+		},
+		{
+			name:    "newer change cancels the build",
+			blocked: 1,
+			run: func(t *testing.T, s *buildScheduler, f *fakeBuilds) {
+				f.touch("a.go")
+				s.Schedule("a.go")
+				waitFor(t, "the first build", func() bool { return f.started() == 1 })
+				f.touch("b.go")
+				s.Schedule("b.go")
+			},
+			wantBuilds:    [][]string{{"a.go"}, {"a.go", "b.go"}},
+			wantCancelled: []bool{true, false},
+		},
+		{
+			name:    "cancelled files are requeued",
+			blocked: 1,
+			run: func(t *testing.T, s *buildScheduler, f *fakeBuilds) {
+				f.touch("a.go")
+				s.Schedule("a.go")
+				f.touch("b.go")
+				s.Schedule("b.go")
+				waitFor(t, "the first build", func() bool { return f.started() == 1 })
+				f.touch("a.go")
+				s.Schedule("a.go")
+			},
+			wantBuilds:    [][]string{{"a.go", "b.go"}, {"a.go", "b.go"}},
+			wantCancelled: []bool{true, false},
+		},
+		{
+			name: "trigger builds without changes",
+			run: func(t *testing.T, s *buildScheduler, f *fakeBuilds) {
+				s.Trigger()
+			},
+			wantBuilds:    [][]string{{}},
+			wantCancelled: []bool{false},
+		},
+		{
+			name: "unmodified file is dropped",
+			run: func(t *testing.T, s *buildScheduler, f *fakeBuilds) {
+				f.touch("a.go")
+				if !s.Schedule("a.go") {
+					t.Errorf("Schedule of a modified file returned false")
+				}
+				waitFor(t, "the first build", func() bool { return f.started() == 1 })
+				if s.Schedule("a.go") {
+					t.Errorf("Schedule of an unmodified file returned true")
+				}
+			},
+			wantBuilds:    [][]string{{"a.go"}},
+			wantCancelled: []bool{false},
+		},
+	}
+
+	for _, test := range tests {
+		f := &fakeBuilds{files: make(map[string]int64), blocked: test.blocked}
+		s := newBuildScheduler(testDelay, f.build)
+		s.modTime = f.modTime
+
+		test.run(t, s, f)
+		waitFor(t, test.name, func() bool { return f.started() >= len(test.wantBuilds) })
+		// Leave time for any unexpected build to start.
+		time.Sleep(5 * testDelay)
+
+		f.mu.Lock()
+		if !reflect.DeepEqual(f.builds, test.wantBuilds) {
+			t.Errorf("%s: got builds %q, want %q", test.name, f.builds, test.wantBuilds)
+		}
+		if !reflect.DeepEqual(f.cancelled, test.wantCancelled) {
+			t.Errorf("%s: got cancelled builds %v, want %v", test.name, f.cancelled, test.wantCancelled)
+		}
+		if f.overlap {
+			t.Errorf("%s: builds overlapped", test.name)
+		}
+		f.mu.Unlock()
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+	"github.com/ClearGrass/qpbee/utils"
+)
+
+var (
+	testResultRegExp    = regexp.MustCompile(`^(\s*)--- (PASS|FAIL|SKIP): (\S+)`)
+	testPkgFailRegExp   = regexp.MustCompile(`^FAIL\s+(\S+)\s+\[(.+)\]`)
+	testPkgResultRegExp = regexp.MustCompile(`^(?:ok|FAIL)\s+(\S+)\s`)
+	testNoiseRegExp     = regexp.MustCompile(`^\s*(=== (RUN|PAUSE|CONT)|--- (PASS|SKIP):)|^PASS$`)
+)
+
+// goPackage is a package of the application as listed by "go list"
+type goPackage struct {
+	importPath  string
+	dir         string
+	deps        map[string]bool // Transitive dependencies.
+	testImports []string        // Imports of the test files.
+}
+
+// testSummary sums up the output of "go test -v"
+type testSummary struct {
+	passed, failed, skipped int
+	failedTests             []string // Failed tests, including subtests.
+	failedPackages          []string // Packages which failed, e.g. because they do not build.
+}
+
+func (s testSummary) String() string {
+	return fmt.Sprintf("%d passed, %d failed, %d skipped", s.passed, s.failed, s.skipped)
+}
+
+// ok reports whether no test nor package failed
+func (s testSummary) ok() bool {
+	return s.failed == 0 && len(s.failedPackages) == 0
+}
+
+// autoTest runs the tests of the packages affected by the changed files, that is
+// the packages containing them and the packages depending on these, including
+// through their tests. All the tests are run when no file changed.
+func autoTest(ctx context.Context, changed []string) {
+	pkgs, err := listPackages(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			beeLogger.Log.Errorf("Failed to list the packages: %s", err)
+		}
+		return
+	}
+
+	var targets []string
+	if len(changed) == 0 {
+		for importPath := range pkgs {
+			targets = append(targets, importPath)
+		}
+		sort.Strings(targets)
+	} else {
+		targets = affectedPackages(pkgs, changed)
+	}
+	if len(targets) == 0 {
+		beeLogger.Log.Hint("No package to test for these changes")
+		return
+	}
+
+	beeLogger.Log.Infof("Testing %s...", describePackages(targets))
+	emitEvent(event{Type: evTestStart, Packages: targets})
+	start := time.Now()
+
+	args := []string{"test", "-v"}
+	if buildTags != "" {
+		args = append(args, "-tags", buildTags)
+	}
+	args = append(args, targets...)
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = currpath
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Run()
+
+	finish := event{Type: evTestFinish, Duration: float64(time.Since(start)) / float64(time.Millisecond)}
+	if ctx.Err() != nil {
+		beeLogger.Log.Info("Tests cancelled, newer changes detected")
+		finish.Status = statusCancelled
+		emitEvent(finish)
+		return
+	}
+
+	summary := parseTestOutput(output.String())
+	if err != nil && summary.ok() {
+		// Failed without any test result, e.g. the go tool itself failed
+		summary.failedPackages = append(summary.failedPackages, strings.Join(targets, " "))
+	}
+	finish.Passed, finish.Failed, finish.Skipped = summary.passed, summary.failed, summary.skipped
+	finish.FailedTests = append(summary.failedTests, summary.failedPackages...)
+
+	elapsed := time.Since(start).Seconds()
+	if summary.ok() {
+		finish.Status = statusOK
+		emitEvent(finish)
+		beeLogger.Log.Successf("Tests passed: %s (%.2fs)", summary, elapsed)
+		utils.Notify(summary.String(), "Tests Passed")
+		return
+	}
+
+	finish.Status = statusFailed
+	emitEvent(finish)
+	os.Stdout.Write(filterTestOutput(output.String()))
+	beeLogger.Log.Errorf("Tests failed: %s (%.2fs)\n%s", summary, elapsed, strings.Join(finish.FailedTests, "\n"))
+	utils.Notify(fmt.Sprintf("%s\n%s", summary, strings.Join(finish.FailedTests, ", ")), "Tests Failed")
+}
+
+// listPackages lists the packages of the application with "go list"
+func listPackages(ctx context.Context) (map[string]*goPackage, error) {
+	args := []string{"list", "-e"}
+	if buildTags != "" {
+		args = append(args, "-tags", buildTags)
+	}
+	args = append(args, "-f", `{{.ImportPath}}{{"\t"}}{{.Dir}}{{"\t"}}{{join .Deps " "}}{{"\t"}}{{join .TestImports " "}} {{join .XTestImports " "}}`, "./...")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = currpath
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	pkgs := make(map[string]*goPackage)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		p := &goPackage{
+			importPath:  fields[0],
+			dir:         fields[1],
+			deps:        make(map[string]bool),
+			testImports: strings.Fields(fields[3]),
+		}
+		for _, dep := range strings.Fields(fields[2]) {
+			p.deps[dep] = true
+		}
+		pkgs[p.importPath] = p
+	}
+	return pkgs, scanner.Err()
+}
+
+// affectedPackages returns the sorted import paths of the packages containing
+// the changed files, and of the packages depending on them or whose tests do.
+func affectedPackages(pkgs map[string]*goPackage, changed []string) []string {
+	byDir := make(map[string]string, len(pkgs))
+	for _, p := range pkgs {
+		byDir[p.dir] = p.importPath
+	}
+
+	changedPkgs := make(map[string]bool)
+	for _, name := range changed {
+		if importPath, ok := byDir[path.Dir(name)]; ok {
+			changedPkgs[importPath] = true
+		}
+	}
+	if len(changedPkgs) == 0 {
+		return nil
+	}
+
+	dependsOnChanges := func(importPath string) bool {
+		if changedPkgs[importPath] {
+			return true
+		}
+		p, ok := pkgs[importPath]
+		if !ok {
+			return false
+		}
+		for c := range changedPkgs {
+			if p.deps[c] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var affected []string
+	for importPath, p := range pkgs {
+		if dependsOnChanges(importPath) {
+			affected = append(affected, importPath)
+			continue
+		}
+		for _, imp := range p.testImports {
+			if dependsOnChanges(imp) {
+				affected = append(affected, importPath)
+				break
+			}
+		}
+	}
+	sort.Strings(affected)
+	return affected
+}
+
+// parseTestOutput counts the results of the top-level tests in the output of
+// "go test -v" and collects the names of the failed tests and packages.
+// Failed tests are named after their package, which is only known once
+// the result line of the package is reached.
+func parseTestOutput(output string) testSummary {
+	var (
+		s       testSummary
+		pending []string
+	)
+	for _, line := range strings.Split(output, "\n") {
+		if m := testResultRegExp.FindStringSubmatch(line); m != nil {
+			topLevel := m[1] == ""
+			switch m[2] {
+			case "PASS":
+				if topLevel {
+					s.passed++
+				}
+			case "FAIL":
+				if topLevel {
+					s.failed++
+				}
+				pending = append(pending, m[3])
+			case "SKIP":
+				if topLevel {
+					s.skipped++
+				}
+			}
+			continue
+		}
+		// e.g. "FAIL	app/models [build failed]"
+		if m := testPkgFailRegExp.FindStringSubmatch(line); m != nil {
+			s.failedPackages = append(s.failedPackages, fmt.Sprintf("%s [%s]", m[1], m[2]))
+			continue
+		}
+		if m := testPkgResultRegExp.FindStringSubmatch(line); m != nil {
+			for _, name := range pending {
+				s.failedTests = append(s.failedTests, m[1]+"."+name)
+			}
+			pending = nil
+		}
+	}
+	return s
+}
+
+// filterTestOutput drops the progress lines of passed and skipped tests
+// from the output of "go test -v"
+func filterTestOutput(output string) []byte {
+	var buf bytes.Buffer
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if !testNoiseRegExp.MatchString(strings.TrimRight(line, "\n")) {
+			buf.WriteString(line)
+		}
+	}
+	return buf.Bytes()
+}
+
+// describePackages returns a short, human readable list of packages
+func describePackages(pkgs []string) string {
+	const maxListed = 3
+	if len(pkgs) <= maxListed {
+		return strings.Join(pkgs, ", ")
+	}
+	return fmt.Sprintf("%s and %d more packages", strings.Join(pkgs[:maxListed], ", "), len(pkgs)-maxListed)
+}
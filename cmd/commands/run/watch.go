@@ -16,15 +16,18 @@ package run
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"os"
 	"os/exec"
+	path "path/filepath"
 	"regexp"
-	"runtime"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/ClearGrass/qpbee/config"
+	"github.com/ClearGrass/qpbee/generate/swaggergen"
 	beeLogger "github.com/ClearGrass/qpbee/logger"
 	"github.com/ClearGrass/qpbee/logger/colors"
 	"github.com/ClearGrass/qpbee/utils"
@@ -32,10 +35,8 @@ import (
 )
 
 var (
-	cmd                 *exec.Cmd
-	state               sync.Mutex
-	eventTime           = make(map[string]int64)
-	scheduleTime        time.Time
+	procMu              sync.Mutex // Serializes starting and stopping the processes.
+	scheduler           *buildScheduler
 	watchExts           = []string{".go"}
 	watchExtsStatic     = []string{".html", ".tpl", ".js", ".css"}
 	ignoredFilesRegExps = []string{
@@ -44,73 +45,256 @@ var (
 		`(\w+).go~`,
 		`(\w+).tmp`,
 	}
+	ignoredFiles  []*regexp.Regexp
+	excludedGlobs *globMatcher
+	watchedDirs   = make(map[string]bool)
+	watchedMu     sync.Mutex // Guards the updates of watchedDirs.
 )
 
-// NewWatcher starts an fsnotify Watcher on the specified paths
+// dirWatcher is implemented by fsnotify.Watcher and pollWatcher
+type dirWatcher interface {
+	Add(name string) error
+	Remove(name string) error
+}
+
+// NewWatcher starts a Watcher on the specified paths: an fsnotify Watcher by
+// default, or a polling one if a poll interval is set. Directories created
+// later are watched as they appear and unwatched when removed.
 func NewWatcher(paths []string, files []string, isgenerate bool) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		beeLogger.Log.Fatalf("Failed to create watcher: %s", err)
+	var (
+		watcher dirWatcher
+		events  <-chan fsnotify.Event
+		errors  <-chan error
+	)
+	if pollInterval > 0 {
+		pw := newPollWatcher(pollInterval)
+		watcher, events, errors = pw, pw.Events, pw.Errors
+		beeLogger.Log.Infof("Polling for changes every %s", pollInterval)
+	} else {
+		fw, err := fsnotify.NewWatcher()
+		if err != nil {
+			beeLogger.Log.Fatalf("Failed to create watcher: %s", err)
+		}
+		watcher, events, errors = fw, fw.Events, fw.Errors
+	}
+
+	// Wait 1s before autobuild until there is no file change.
+	scheduler = newBuildScheduler(1*time.Second, func(ctx context.Context, changed []string) {
+		if len(changed) > 0 {
+			beeLogger.Log.Infof("Rebuilding after changes in %s", describeChanges(changed))
+		}
+		if !testOnly {
+			autoBuild(ctx, changed, files, isgenerate)
+		}
+		if testMode || testOnly {
+			autoTest(ctx, changed)
+		}
+	})
+
+	beeLogger.Log.Info("Initializing watcher...")
+	for _, path := range paths {
+		beeLogger.Log.Hintf(colors.Bold("Watching: ")+"%s", path)
+		err := watcher.Add(path)
+		if err != nil {
+			beeLogger.Log.Fatalf("Failed to watch directory: %s", err)
+		}
+		watchedMu.Lock()
+		watchedDirs[path] = true
+		watchedMu.Unlock()
 	}
 
 	go func() {
 		for {
 			select {
-			case e := <-watcher.Events:
-				isBuild := true
-
-				if ifStaticFile(e.Name) && config.Conf.EnableReload {
-					sendReload(e.String())
-					continue
-				}
-				// Skip ignored files
-				if shouldIgnoreFile(e.Name) {
+			case e := <-events:
+				if e.Op&fsnotify.Create == fsnotify.Create && isDirectory(e.Name) {
+					if shouldWatchDir(e.Name) {
+						watchNewDirectory(watcher, e.Name)
+					}
 					continue
 				}
-				if !shouldWatchFileWithExtension(e.Name) {
+				if e.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && watchedDirs[e.Name] {
+					unwatchDirectory(watcher, e.Name)
 					continue
 				}
-
-				mt := utils.GetFileModTime(e.Name)
-				if t := eventTime[e.Name]; mt == t {
-					beeLogger.Log.Hintf(colors.Bold("Skipping: ")+"%s", e.String())
-					isBuild = false
-				}
-
-				eventTime[e.Name] = mt
-
-				if isBuild {
-					beeLogger.Log.Hintf("Event fired: %s", e)
-					go func() {
-						// Wait 1s before autobuild until there is no file change.
-						scheduleTime = time.Now().Add(1 * time.Second)
-						time.Sleep(scheduleTime.Sub(time.Now()))
-						AutoBuild(files, isgenerate)
-					}()
-				}
-			case err := <-watcher.Errors:
+				handleFileEvent(e)
+			case err := <-errors:
 				beeLogger.Log.Warnf("Watcher error: %s", err.Error()) // No need to exit here
 			}
 		}
 	}()
+}
 
-	beeLogger.Log.Info("Initializing watcher...")
-	for _, path := range paths {
-		beeLogger.Log.Hintf(colors.Bold("Watching: ")+"%s", path)
-		err = watcher.Add(path)
+// handleFileEvent live-reloads static files and schedules
+// a rebuild when watched files change.
+func handleFileEvent(e fsnotify.Event) {
+	// Skip ignored files
+	if shouldIgnoreFile(e.Name) {
+		return
+	}
+	if isPaused() {
+		return
+	}
+	if ifStaticFile(e.Name) && config.Conf.EnableReload {
+		emitEvent(event{Type: evWatch, Op: e.Op.String(), Path: relPath(e.Name)})
+		// Stylesheets are swapped in place, other files reload the page
+		if strings.HasSuffix(e.Name, ".css") && e.Op&(fsnotify.Remove|fsnotify.Rename) == 0 {
+			sendReloadMessage(reloadMessage{Type: msgCSSChanged, Path: relPath(e.Name)})
+		} else {
+			sendReload(relPath(e.Name))
+		}
+		return
+	}
+	if !shouldWatchFileWithExtension(e.Name) && !hookFiles.Match(e.Name, false) && !programFiles.Match(e.Name, false) {
+		return
+	}
+	emitEvent(event{Type: evWatch, Op: e.Op.String(), Path: relPath(e.Name)})
+
+	if scheduler.Schedule(e.Name) {
+		beeLogger.Log.Hintf("Event fired: %s", e)
+	} else {
+		beeLogger.Log.Hintf(colors.Bold("Skipping: ")+"%s", e.String())
+	}
+}
+
+// watchNewDirectory watches a directory created after startup along with
+// its sub-directories. The files they already contain are handled as
+// created since their own events may have been missed.
+func watchNewDirectory(watcher dirWatcher, dir string) {
+	path.Walk(dir, func(p string, fi os.FileInfo, err error) error {
 		if err != nil {
-			beeLogger.Log.Fatalf("Failed to watch directory: %s", err)
+			return nil
+		}
+		if fi.IsDir() {
+			if p != dir && !shouldWatchDir(p) {
+				return path.SkipDir
+			}
+			if watchedDirs[p] {
+				return nil
+			}
+			if err := watcher.Add(p); err != nil {
+				beeLogger.Log.Warnf("Failed to watch directory: %s", err)
+				return path.SkipDir
+			}
+			watchedMu.Lock()
+			watchedDirs[p] = true
+			watchedMu.Unlock()
+			beeLogger.Log.Infof(colors.Bold("Watching: ")+"%s", p)
+			return nil
+		}
+		handleFileEvent(fsnotify.Event{Name: p, Op: fsnotify.Create})
+		return nil
+	})
+}
+
+// unwatchDirectory stops watching a removed directory and its sub-directories
+func unwatchDirectory(watcher dirWatcher, dir string) {
+	for p := range watchedDirs {
+		if p == dir || strings.HasPrefix(p, dir+string(path.Separator)) {
+			// The watch is usually gone already along with the directory
+			watcher.Remove(p)
+			watchedMu.Lock()
+			delete(watchedDirs, p)
+			watchedMu.Unlock()
+			beeLogger.Log.Infof(colors.Bold("No longer watching: ")+"%s", p)
 		}
 	}
 }
 
-// AutoBuild builds the specified set of files
+// isDirectory returns true if the path exists and is a directory
+func isDirectory(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+// AutoBuild builds the specified set of files.
+// Once the watcher is started, builds go through its scheduler so that
+// they never overlap with the rebuilds triggered by file changes.
 func AutoBuild(files []string, isgenerate bool) {
-	state.Lock()
-	defer state.Unlock()
+	if scheduler != nil {
+		scheduler.Trigger()
+		return
+	}
+	autoBuild(context.Background(), nil, files, isgenerate)
+}
 
+// autoBuild builds the specified set of files and restarts the application,
+// along with the other processes. Once several processes are supervised, only
+// those affected by the changed files are rebuilt and restarted.
+// It gives up as soon as ctx is cancelled, i.e. newer changes are pending.
+// The browsers connected to the reload server are told about the progress
+// and about the compiler errors of a failed build.
+func autoBuild(ctx context.Context, changed []string, files []string, isgenerate bool) {
 	os.Chdir(currpath)
 
+	targets := programs
+	if len(programs) > 1 && len(changed) > 0 {
+		if targets = affectedPrograms(ctx, changed); ctx.Err() != nil {
+			return
+		}
+		if len(targets) == 0 {
+			beeLogger.Log.Hint("No process depends on these changes")
+			return
+		}
+		beeLogger.Log.Infof("Rebuilding %s", describePrograms(targets))
+	}
+	withApp := targets[0] == app
+
+	started := reloadMessage{Type: msgBuildStarted}
+	for _, name := range changed {
+		started.Files = append(started.Files, relPath(name))
+	}
+	sendReloadMessage(started)
+	emitEvent(event{Type: evBuildStart, Files: started.Files})
+	if withApp {
+		holdRequests()
+	}
+
+	buildStart := time.Now()
+	finish := func(status string, output string, errs []buildError) {
+		duration := float64(time.Since(buildStart)) / float64(time.Millisecond)
+		recordBuild(status, duration)
+		emitEvent(event{
+			Type:        evBuildFinish,
+			Status:      status,
+			Duration:    duration,
+			Diagnostics: errs,
+			Output:      output,
+		})
+	}
+
+	// buildFailed reports a failure of the build cycle, unless it was cancelled
+	buildFailed := func(output string, errs []buildError) {
+		if ctx.Err() != nil {
+			beeLogger.Log.Info("Build cancelled, newer changes detected")
+			finish(statusCancelled, "", nil)
+			return
+		}
+		finish(statusFailed, output, errs)
+		failure := reloadMessage{Type: msgBuildFailed, Errors: errs, Output: output}
+		sendReloadMessage(failure)
+		// The proxy only shows the failures of the application, which it held the requests for
+		if withApp {
+			releaseRequests(&failure)
+		}
+		if err := runHooks(ctx, hookOnBuildFailure, changed); err != nil {
+			beeLogger.Log.Error(err.Error())
+		}
+	}
+
+	hookFailed := func(err error) {
+		if ctx.Err() == nil {
+			utils.Notify(err.Error(), "Build Failed")
+			beeLogger.Log.Error(err.Error())
+		}
+		buildFailed(err.Error(), nil)
+	}
+
+	if err := runHooks(ctx, hookPreBuild, changed); err != nil {
+		hookFailed(err)
+		return
+	}
+
 	cmdName := "go"
 
 	var (
@@ -120,92 +304,360 @@ func AutoBuild(files []string, isgenerate bool) {
 	// For applications use full import path like "github.com/.../.."
 	// are able to use "go install" to reduce build time.
 	if config.Conf.GoInstall {
-		icmd := exec.Command(cmdName, "install", "-v")
+		icmd := exec.CommandContext(ctx, cmdName, "install", "-v")
 		icmd.Stdout = os.Stdout
 		icmd.Stderr = os.Stderr
-		icmd.Env = append(os.Environ(), "GOGC=off")
+		icmd.Env = append(append(os.Environ(), "GOGC=off"), config.Conf.Build.Envs...)
 		icmd.Run()
 	}
 
-	if isgenerate {
-		beeLogger.Log.Info("Generating the docs...")
-		icmd := exec.Command("bee", "generate", "docs")
-		icmd.Env = append(os.Environ(), "GOGC=off")
-		err = icmd.Run()
+	if isgenerate && withApp && ctx.Err() == nil {
+		// The docs are only generated again when the routers,
+		// the controllers or their models changed
+		written, err := swaggergen.UpdateDocs(currpath)
 		if err != nil {
-			utils.Notify("", "Failed to generate the docs.")
-			beeLogger.Log.Errorf("Failed to generate the docs.")
+			utils.Notify(err.Error(), "Failed to generate the docs.")
+			beeLogger.Log.Errorf("Failed to generate the docs: %s", err)
+			buildFailed(err.Error(), nil)
 			return
 		}
-		beeLogger.Log.Success("Docs generated!")
+		if written {
+			beeLogger.Log.Success("Docs generated!")
+		}
 	}
 
-	if err == nil {
-		appName := appname
-		if runtime.GOOS == "windows" {
-			appName += ".exe"
+	for _, p := range targets {
+		if p.command != "" {
+			continue
+		}
+		main := p.main
+		if p == app {
+			main = files
 		}
 
 		args := []string{"build"}
-		args = append(args, "-o", appName)
-		if buildTags != "" {
-			args = append(args, "-tags", buildTags)
-		}
-		args = append(args, files...)
+		args = append(args, "-o", p.binary())
+		args = append(args, buildArgs()...)
+		args = append(args, main...)
 
-		bcmd := exec.Command(cmdName, args...)
-		bcmd.Env = append(os.Environ(), "GOGC=off")
+		stderr.Reset()
+		bcmd := exec.CommandContext(ctx, cmdName, args...)
+		bcmd.Env = append(append(os.Environ(), "GOGC=off"), config.Conf.Build.Envs...)
 		bcmd.Stderr = &stderr
 		err = bcmd.Run()
+		if ctx.Err() != nil {
+			beeLogger.Log.Info("Build cancelled, newer changes detected")
+			finish(statusCancelled, "", nil)
+			return
+		}
 		if err != nil {
 			utils.Notify(stderr.String(), "Build Failed")
-			beeLogger.Log.Errorf("Failed to build the application: %s", stderr.String())
+			if p == app {
+				beeLogger.Log.Errorf("Failed to build the application: %s", stderr.String())
+			} else {
+				beeLogger.Log.Errorf("Failed to build '%s': %s", p.name, stderr.String())
+			}
+			buildFailed(stderr.String(), parseBuildErrors(stderr.String()))
 			return
 		}
 	}
 
 	beeLogger.Log.Success("Built Successfully!")
-	Restart(appname)
+
+	for _, stage := range []string{hookPostBuild, hookPreRestart} {
+		if err := runHooks(ctx, stage, changed); err != nil {
+			hookFailed(err)
+			return
+		}
+	}
+
+	finish(statusOK, "", nil)
+	sendReloadMessage(reloadMessage{Type: msgBuildOK})
+	restartProcesses(targets)
 }
 
-// Kill kills the running command process
+// describeChanges returns a short, human readable list of the changed files
+func describeChanges(changed []string) string {
+	const maxListed = 5
+
+	names := make([]string, 0, maxListed)
+	for i, name := range changed {
+		if i == maxListed {
+			break
+		}
+		names = append(names, relPath(name))
+	}
+
+	desc := strings.Join(names, ", ")
+	if len(changed) > maxListed {
+		desc += fmt.Sprintf(" and %d more", len(changed)-maxListed)
+	}
+	return desc
+}
+
+// relPath returns the path relative to the application directory, with forward
+// slashes, or the path unchanged if it is outside of the application.
+func relPath(name string) string {
+	rel, err := path.Rel(currpath, name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return name
+	}
+	return path.ToSlash(rel)
+}
+
+// Kill stops the running processes. The configured stop signal
+// is sent to their process group first, and the group is killed if
+// the process is still running after the stop timeout.
 func Kill() {
+	procMu.Lock()
+	defer procMu.Unlock()
+	for _, p := range programs {
+		p.kill()
+	}
+}
+
+func (prog *program) kill() {
 	defer func() {
 		if e := recover(); e != nil {
 			beeLogger.Log.Infof("Kill recover: %s", e)
 		}
 	}()
-	if cmd != nil && cmd.Process != nil {
-		err := cmd.Process.Kill()
-		if err != nil {
-			beeLogger.Log.Errorf("Error while killing cmd process: %s", err)
-		}
+	if prog.proc == nil || prog.proc.exited() {
+		return
+	}
+
+	timeout := time.Duration(config.Conf.Process.StopTimeout) * time.Second
+	killed, err := prog.proc.stop(config.Conf.Process.StopSignal, timeout)
+	if err != nil {
+		beeLogger.Log.Errorf("Error while stopping cmd process: %s", err)
+	}
+	if killed {
+		beeLogger.Log.Warnf("'%s' did not stop within %s and was killed", prog.name, timeout)
 	}
 }
 
-// Restart kills the running command process and starts it again
-func Restart(appname string) {
+// Restart kills the running process of the application, or of the named
+// process, and starts it again from a new build, which resets the crash
+// restart counter.
+func Restart(name string) {
+	if p := findProgram(name); p != nil {
+		restartPrograms([]*program{p})
+	}
+}
+
+// restartPrograms runs the pre_restart hooks, then restarts the processes of the
+// programs. Nothing is restarted if a hook fails.
+func restartPrograms(progs []*program) {
+	if err := runHooks(context.Background(), hookPreRestart, nil); err != nil {
+		beeLogger.Log.Errorf("Not restarting %s: %s", describePrograms(progs), err)
+		return
+	}
+	restartProcesses(progs)
+}
+
+// restartProcesses restarts the processes of the programs, once the
+// pre_restart hooks have run
+func restartProcesses(progs []*program) {
+	procMu.Lock()
+	defer procMu.Unlock()
+
 	beeLogger.Log.Debugf("Kill running process", utils.FILE(), utils.LINE())
-	Kill()
-	go Start(appname)
+	for _, p := range progs {
+		p.kill()
+		p.restarts = 0
+		p.start()
+	}
+}
+
+// Start starts the process of the application, or of the named process.
+// The application is reported as running once it accepts connections
+// on its HTTP port.
+func Start(name string) {
+	procMu.Lock()
+	defer procMu.Unlock()
+	if p := findProgram(name); p != nil {
+		p.start()
+	}
+}
+
+// findProgram returns the application or the process with the given name
+func findProgram(name string) *program {
+	for _, p := range programs {
+		if p.name == name {
+			return p
+		}
+	}
+	beeLogger.Log.Errorf("No process named '%s'", name)
+	return nil
+}
+
+func (prog *program) start() {
+	beeLogger.Log.Infof("Restarting '%s'...", prog.name)
+	if prog == app {
+		holdRequests()
+	}
+
+	var cmd *exec.Cmd
+	if prog.command != "" {
+		args := shellArgs(prog.command)
+		cmd = exec.Command(args[0], args[1:]...)
+	} else {
+		// The binary is named as if it were in the application directory,
+		// where applications may look for their files based on os.Args[0]
+		bin := prog.binary()
+		cmd = exec.Command(bin)
+		cmd.Args = append([]string{"./" + path.Base(bin)}, prog.args...)
+	}
+	cmd.Stdout = prog.stdout
+	cmd.Stderr = prog.stderr
+	cmd.Env = append(append(os.Environ(), prog.envs...), processEnv()...)
+
+	p, err := startProcess(cmd)
+	if err != nil {
+		beeLogger.Log.Errorf("Failed to start '%s': %s", prog.name, err)
+		if prog == app {
+			releaseRequests(nil)
+		}
+		return
+	}
+	prog.proc = p
+	emitEvent(event{Type: evProcessStart, Process: prog.name, PID: cmd.Process.Pid})
+	go prog.supervise(p)
+
+	if prog != app {
+		beeLogger.Log.Successf("'%s' is running...", prog.name)
+		return
+	}
+	recordStart()
+
+	port := appHTTPPort()
+	if port == 0 {
+		beeLogger.Log.Successf("'%s' is running...", prog.name)
+		releaseRequests(nil)
+		return
+	}
+
+	go func() {
+		timeout := time.Duration(config.Conf.Process.ReadyTimeout) * time.Second
+		ready := p.waitReady(port, timeout)
+		releaseRequests(nil)
+		if !ready {
+			if !p.exited() {
+				beeLogger.Log.Warnf("'%s' is not accepting connections on port %d after %s", prog.name, port, timeout)
+			}
+			return
+		}
+		beeLogger.Log.Successf("'%s' is running on port %d...", prog.name, port)
+		emitEvent(event{Type: evProcessReady, Process: prog.name, PID: cmd.Process.Pid, Port: port})
+		if config.Conf.EnableReload {
+			sendReload(prog.name)
+		}
+	}()
 }
 
-// Start starts the command process
-func Start(appname string) {
-	beeLogger.Log.Infof("Restarting '%s'...", appname)
-	if !strings.Contains(appname, "./") {
-		appname = "./" + appname
+// supervise waits for the process to exit and, unless bee stopped it,
+// restarts it according to the configured restart policy. Restarts are
+// delayed with an exponential backoff and stop once the same build has
+// crashed too many times.
+func (prog *program) supervise(p *appProcess) {
+	<-p.done
+	emitEvent(processExitEvent(prog, p))
+	if p.stopped() {
+		return
+	}
+
+	policy := config.Conf.Process.Restart
+	if p.err == nil && policy != "always" {
+		beeLogger.Log.Infof("'%s' exited (%s)", prog.name, p.exitStatus())
+		return
 	}
+	beeLogger.Log.Errorf("'%s' exited unexpectedly (%s)", prog.name, p.exitStatus())
+	if policy == "never" {
+		return
+	}
+
+	procMu.Lock()
+	if prog.proc != p {
+		// A newer build has already replaced the process
+		procMu.Unlock()
+		return
+	}
+	prog.restarts++
+	n := prog.restarts
+	procMu.Unlock()
 
-	cmd = exec.Command(appname)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Args = append([]string{appname}, config.Conf.CmdArgs...)
-	cmd.Env = append(os.Environ(), config.Conf.Envs...)
+	max := config.Conf.Process.MaxRestarts
+	if n > max {
+		beeLogger.Log.Errorf("'%s' keeps crashing, giving up after %d restarts. Waiting for changes...", prog.name, max)
+		utils.Notify(fmt.Sprintf("'%s' crashed %d times in a row (%s)", prog.name, n, p.exitStatus()), "Restart Failed")
+		return
+	}
+
+	// Hold the requests until the application is back
+	delay := restartDelay(n)
+	if prog == app {
+		holdRequests()
+	}
+	beeLogger.Log.Warnf("Restarting '%s' in %s (attempt %d/%d)...", prog.name, delay, n, max)
+	time.Sleep(delay)
 
-	go cmd.Run()
-	beeLogger.Log.Successf("'%s' is running...", appname)
-	started <- true
+	if err := runHooks(context.Background(), hookPreRestart, nil); err != nil {
+		beeLogger.Log.Errorf("Not restarting '%s': %s. Waiting for changes...", prog.name, err)
+		if prog == app {
+			releaseRequests(nil)
+		}
+		return
+	}
+	procMu.Lock()
+	defer procMu.Unlock()
+	if prog.proc == p {
+		prog.start()
+	}
+}
+
+// loadWatchSettings merges the watcher settings of the configuration file
+// with the default extensions and ignore rules.
+func loadWatchSettings() {
+	watchExts = appendExts(watchExts, config.Conf.WatchExts)
+	watchExtsStatic = appendExts(watchExtsStatic, config.Conf.WatchExtsStatic)
+
+	ignoredFiles = nil
+	for _, regex := range append(ignoredFilesRegExps, config.Conf.WatchIgnore...) {
+		r, err := regexp.Compile(regex)
+		if err != nil {
+			beeLogger.Log.Fatalf("Could not compile regular expression: %s", err)
+		}
+		ignoredFiles = append(ignoredFiles, r)
+	}
+
+	// Rules of the configuration file come last so that
+	// they can re-include paths excluded by .gitignore
+	excludedGlobs = newGlobMatcher(currpath, nil)
+	if config.Conf.UseGitignore {
+		if err := excludedGlobs.addFile(path.Join(currpath, ".gitignore")); err != nil {
+			beeLogger.Log.Warnf("Failed to read .gitignore: %s", err)
+		}
+	}
+	excludedGlobs.add(config.Conf.WatchExclude)
+
+	loadHookFiles()
+}
+
+// appendExts appends the extensions which are not in exts yet,
+// adding the leading dot if missing.
+func appendExts(exts []string, extra []string) []string {
+	for _, ext := range extra {
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if !utils.ContainsString(exts, ext) {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
 }
 
 func ifStaticFile(filename string) bool {
@@ -217,20 +669,16 @@ func ifStaticFile(filename string) bool {
 	return false
 }
 
-// shouldIgnoreFile ignores filenames generated by Emacs, Vim or SublimeText.
+// shouldIgnoreFile ignores filenames generated by Emacs, Vim or SublimeText,
+// as well as files matching the ignore and exclude rules of the configuration.
 // It returns true if the file should be ignored, false otherwise.
 func shouldIgnoreFile(filename string) bool {
-	for _, regex := range ignoredFilesRegExps {
-		r, err := regexp.Compile(regex)
-		if err != nil {
-			beeLogger.Log.Fatalf("Could not compile regular expression: %s", err)
-		}
+	for _, r := range ignoredFiles {
 		if r.MatchString(filename) {
 			return true
 		}
-		continue
 	}
-	return false
+	return excludedGlobs.Match(filename, false)
 }
 
 // shouldWatchFileWithExtension returns true if the name of the file
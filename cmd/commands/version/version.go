@@ -169,6 +169,10 @@ func GetGoVersion() string {
 	)
 
 	if cmdOut, err = exec.Command("go", "version").Output(); err != nil {
+		// No Go toolchain, e.g. to run SQL migrations, fall back to the one bee was built with
+		if _, ok := err.(*exec.Error); ok {
+			return runtime.Version()
+		}
 		beeLogger.Log.Fatalf("There was an error running 'go version' command: %s", err)
 	}
 	return strings.Split(string(cmdOut), " ")[2]
@@ -27,22 +27,44 @@ const confVer = 0
 
 var Conf = struct {
 	Version            int
-	GoInstall          bool      `json:"go_install" yaml:"go_install"` // Indicates whether execute "go install" before "go build".
+	GoInstall          bool      `json:"go_install" yaml:"go_install"`             // Indicates whether execute "go install" before "go build".
+	WatchExts          []string  `json:"watch_ext" yaml:"watch_ext"`               // Extra extensions of files triggering a rebuild.
+	WatchExtsStatic    []string  `json:"watch_ext_static" yaml:"watch_ext_static"` // Extra extensions of files triggering a live reload only.
+	WatchExclude       []string  `json:"watch_exclude" yaml:"watch_exclude"`       // Gitignore-style globs of paths not being watched.
+	WatchIgnore        []string  `json:"watch_ignore" yaml:"watch_ignore"`         // Extra regular expressions of file names to ignore.
+	UseGitignore       bool      `json:"use_gitignore" yaml:"use_gitignore"`       // Indicates whether paths ignored by .gitignore are not watched.
+	WatchPoll          string    `json:"watch_poll" yaml:"watch_poll"`             // Interval of the polling watcher (e.g. "1s"), filesystem events are used if empty.
 	DirStruct          dirStruct `json:"dir_structure" yaml:"dir_structure"`
 	CmdArgs            []string  `json:"cmd_args" yaml:"cmd_args"`
 	Envs               []string
+	Build              build
 	Bale               bale
 	Database           database
-	EnableReload       bool              `json:"enable_reload" yaml:"enable_reload"`
-	EnableNotification bool              `json:"enable_notification" yaml:"enable_notification"`
-	Scripts            map[string]string `json:"scripts" yaml:"scripts"`
+	Process            process
+	Processes          []namedProcess `json:"processes" yaml:"processes"`
+	Hooks              hooks
+	EnableReload       bool `json:"enable_reload" yaml:"enable_reload"`
+	Reload             reload
+	Control            control
+	EnableNotification bool               `json:"enable_notification" yaml:"enable_notification"`
+	Scripts            map[string]string  `json:"scripts" yaml:"scripts"`
+	Profiles           map[string]profile `json:"profiles" yaml:"profiles"`
 }{
-	GoInstall: true,
+	GoInstall:       true,
+	WatchExts:       []string{},
+	WatchExtsStatic: []string{},
+	WatchExclude:    []string{},
+	WatchIgnore:     []string{},
+	UseGitignore:    true,
 	DirStruct: dirStruct{
 		Others: []string{},
 	},
 	CmdArgs: []string{},
 	Envs:    []string{},
+	Build: build{
+		Flags: []string{},
+		Envs:  []string{},
+	},
 	Bale: bale{
 		Dirs:   []string{},
 		IngExt: []string{},
@@ -50,8 +72,25 @@ var Conf = struct {
 	Database: database{
 		Driver: "mysql",
 	},
+	Process: process{
+		StopSignal:      "SIGTERM",
+		StopTimeout:     5,
+		ReadyTimeout:    30,
+		Restart:         "on-failure",
+		MaxRestarts:     5,
+		RestartDelay:    1,
+		MaxRestartDelay: 30,
+	},
+	Processes: []namedProcess{},
+	Reload: reload{
+		Port: 12450,
+	},
+	Control: control{
+		Port: 12451,
+	},
 	EnableNotification: true,
 	Scripts:            map[string]string{},
+	Profiles:           map[string]profile{},
 }
 
 // dirStruct describes the application's directory structure
@@ -62,6 +101,21 @@ type dirStruct struct {
 	Others      []string // Other directories
 }
 
+// build holds the settings of "go build" used by "bee run"
+type build struct {
+	Tags     string   `json:"tags" yaml:"tags"`
+	Ldflags  string   `json:"ldflags" yaml:"ldflags"` // Environment variables are expanded, e.g. "-X main.version=${VERSION}".
+	Gcflags  string   `json:"gcflags" yaml:"gcflags"`
+	Mod      string   `json:"mod" yaml:"mod"` // Module download mode, e.g. "vendor".
+	Race     bool     `json:"race" yaml:"race"`
+	Cover    bool     `json:"cover" yaml:"cover"`         // Build a coverage-instrumented binary (Go 1.20+).
+	CoverPkg string   `json:"cover_pkg" yaml:"cover_pkg"` // Packages instrumented for coverage, the main package's by default.
+	CoverDir string   `json:"cover_dir" yaml:"cover_dir"` // Directory of the coverage data, "coverage" in the output directory by default.
+	Flags    []string `json:"flags" yaml:"flags"`         // Extra flags of "go build".
+	Envs     []string // Environment of "go build", e.g. "CGO_ENABLED=0".
+	Output   string   `json:"output" yaml:"output"` // Directory of the binaries, a temporary directory by default.
+}
+
 // bale
 type bale struct {
 	Import string
@@ -75,6 +129,84 @@ type database struct {
 	Conn   string
 }
 
+// profile holds the settings applied by "bee run -profile", on top of the main ones
+type profile struct {
+	CmdArgs  []string `json:"cmd_args" yaml:"cmd_args"` // Replace the main arguments if not empty.
+	Envs     []string // Added to the main variables, replacing those with the same name.
+	Database database // Passed to the application as BEE_DB_DRIVER and BEE_DB_CONN if set.
+}
+
+// reload describes the live-reload server and proxy of "bee run"
+type reload struct {
+	Port      int `json:"port" yaml:"port"`             // Port of the live-reload websocket server.
+	ProxyPort int `json:"proxy_port" yaml:"proxy_port"` // Port of the live-reload proxy in front of the application, disabled if 0.
+}
+
+// control describes the control API of "bee run", listening on the loopback interface
+type control struct {
+	Enable bool `json:"enable" yaml:"enable"`
+	Port   int  `json:"port" yaml:"port"`
+}
+
+// namedProcess is a process supervised by "bee run" along with the application, e.g. a worker
+type namedProcess struct {
+	Name    string   `json:"name" yaml:"name"`
+	Main    []string `json:"main" yaml:"main"`       // Main package directory or files of the process, e.g. "./cmd/worker".
+	Command string   `json:"command" yaml:"command"` // Shell command run as is, instead of building a main package.
+	CmdArgs []string `json:"cmd_args" yaml:"cmd_args"`
+	Envs    []string // Added to the main variables, replacing those with the same name.
+	Watch   []string `json:"watch" yaml:"watch"` // Gitignore-style globs of extra files rebuilding the process.
+}
+
+// hooks lists the commands run by "bee run" during each build cycle
+type hooks struct {
+	PreBuild       []Hook `json:"pre_build" yaml:"pre_build"`               // Run before building the application.
+	PostBuild      []Hook `json:"post_build" yaml:"post_build"`             // Run once the application is built.
+	PreRestart     []Hook `json:"pre_restart" yaml:"pre_restart"`           // Run right before the application is restarted.
+	OnBuildFailure []Hook `json:"on_build_failure" yaml:"on_build_failure"` // Run when the build cycle fails.
+}
+
+// Hook is a command run by "bee run". It is either a shell command or the name of
+// one of the scripts, and can be written as a plain string holding the command.
+type Hook struct {
+	Run    string   `json:"run" yaml:"run"`       // Shell command.
+	Script string   `json:"script" yaml:"script"` // Name of the script to run instead of a command.
+	Files  []string `json:"files" yaml:"files"`   // Gitignore-style globs of the files the hook is run for.
+}
+
+// UnmarshalJSON allows a hook to be written as a plain command string
+func (h *Hook) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &h.Run); err == nil {
+		return nil
+	}
+	type plain Hook
+	return json.Unmarshal(data, (*plain)(h))
+}
+
+// UnmarshalYAML allows a hook to be written as a plain command string
+func (h *Hook) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&h.Run); err == nil {
+		return nil
+	}
+	type plain Hook
+	return unmarshal((*plain)(h))
+}
+
+// process describes how "bee run" stops and starts the application process
+type process struct {
+	StopSignal   string `json:"stop_signal" yaml:"stop_signal"`     // Signal sent to stop the application before killing it.
+	StopTimeout  int    `json:"stop_timeout" yaml:"stop_timeout"`   // Seconds to wait for the application to exit after the stop signal.
+	HTTPPort     int    `json:"http_port" yaml:"http_port"`         // Port the application listens on, read from conf/app.conf if not set.
+	ReadyTimeout int    `json:"ready_timeout" yaml:"ready_timeout"` // Seconds to wait for the application to accept connections.
+
+	// Restart policy applied when the application exits on its own:
+	// "on-failure" (default), "always" or "never".
+	Restart         string `json:"restart" yaml:"restart"`
+	MaxRestarts     int    `json:"max_restarts" yaml:"max_restarts"`           // Restarts of the same build before giving up.
+	RestartDelay    int    `json:"restart_delay" yaml:"restart_delay"`         // Seconds before the first restart, doubled after each crash.
+	MaxRestartDelay int    `json:"max_restart_delay" yaml:"max_restart_delay"` // Upper bound of the restart delay in seconds.
+}
+
 // LoadConfig loads the bee tool configuration.
 // It looks for Beefile or bee.json in the current path,
 // and falls back to default configuration in case not found.
@@ -0,0 +1,330 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package dialect holds what bee knows about each SQL database: the bookkeeping
+// tables of the migrations, the introspection of the schema, the mapping of
+// the types and the quoting of the identifiers. "bee migrate",
+// "bee generate migration" and "bee generate appcode" all go through it.
+// Supporting another database means implementing Dialect and registering it.
+package dialect
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockName is the name of the lock of the migrations
+const lockName = "bee_migrations"
+
+// Dialect is the SQL dialect of a database/sql driver
+type Dialect interface {
+	// Name returns the name of the database/sql driver, e.g. "mysql"
+	Name() string
+	// DriverPackage returns the import path of the database/sql driver
+	DriverPackage() string
+	// DefaultConn returns the connection string used when none is given
+	DefaultConn() string
+	// Quote quotes an identifier, e.g. a table or a column name
+	Quote(name string) string
+	// Placeholder returns the placeholder of the nth argument of a query, starting at 1
+	Placeholder(n int) string
+	// BackslashEscapes reports whether a backslash escapes the next character of the
+	// quoted strings, as in MySQL, rather than being a character of its own
+	BackslashEscapes() bool
+
+	// MigrationsTableDDL returns the statements creating the migrations table
+	MigrationsTableDDL() string
+	// MigrationsChecksumDDL returns the statement adding the checksum column to
+	// the migrations table created by an older bee
+	MigrationsChecksumDDL() string
+	// TryLock takes the lock of the migrations for the connection of db, which must
+	// have a single one, released by Unlock or when the connection closes. It returns
+	// the holder of the lock if it is taken.
+	TryLock(db *sql.DB) (holder string, err error)
+	// Unlock releases the lock of the migrations
+	Unlock(db *sql.DB) error
+
+	// Tables returns the tables of the database
+	Tables(db *sql.DB) ([]string, error)
+	// Columns returns the columns of a table, in their order
+	Columns(db *sql.DB, table string) ([]Column, error)
+	// Constraints returns the primary key, unique and foreign key constraints of a table
+	Constraints(db *sql.DB, table string) ([]Constraint, error)
+
+	// ColumnType returns the definition of a column for a field type of
+	// "bee generate", e.g. "string:64" or "datetime", and the table
+	// constraint it needs, if any, with a %s for the column name
+	ColumnType(fieldType string) (definition, constraint string, err error)
+	// IDColumn returns the definition of the auto-incremented "id" primary key
+	// added to the tables of "bee generate" lacking one
+	IDColumn() string
+	// GoType returns the Go type of an SQL data type
+	GoType(dataType string) (string, error)
+
+	// Indexes returns the indexes of a table but its primary key, unique ones included
+	Indexes(db *sql.DB, table string) ([]Index, error)
+	// ModifyColumn returns the statements changing the definition of a column
+	ModifyColumn(table string, c ColumnDef) ([]string, error)
+	// AddForeignKey returns the statement adding a foreign key constraint to a table
+	AddForeignKey(table, name, column, refTable, refColumn string) (string, error)
+	// DropForeignKey returns the statement dropping a foreign key constraint of a table
+	DropForeignKey(table, name string) (string, error)
+	// DropIndex returns the statement dropping an index of a table
+	DropIndex(table, name string) string
+
+	// SyncSequence returns the statement moving the sequence of an auto-incremented
+	// column past the values inserted explicitly, empty if the database does it by itself
+	SyncSequence(table, column string) string
+}
+
+// Column describes a column of a table
+type Column struct {
+	Name          string
+	DataType      string // Data type without its size, e.g. "varchar".
+	ColumnType    string // Complete type, e.g. "varchar(255)" or "int(10) unsigned".
+	Nullable      bool
+	Default       string // Empty if none.
+	PrimaryKey    bool
+	AutoIncrement bool
+	AutoNow       bool // Set to the current time on update.
+	Comment       string
+}
+
+// ColumnDef is the definition of a column in a DDL statement
+type ColumnDef struct {
+	Name    string
+	Type    string // e.g. "varchar(255)".
+	Null    bool
+	Default string // SQL expression, empty if none.
+}
+
+// ColumnSQL returns the definition of a column in a CREATE or ALTER TABLE statement
+func ColumnSQL(d Dialect, c ColumnDef) string {
+	def := d.Quote(c.Name) + " " + c.Type
+	if c.Null {
+		def += " NULL"
+	} else {
+		def += " NOT NULL"
+	}
+	if c.Default != "" {
+		def += " DEFAULT " + c.Default
+	}
+	return def
+}
+
+// Index is an index of a table
+type Index struct {
+	Name       string
+	Columns    []string
+	Unique     bool
+	Constraint bool // Backs a constraint, and cannot be dropped as an index.
+}
+
+// Constraint types
+const (
+	PrimaryKey = "PRIMARY KEY"
+	Unique     = "UNIQUE"
+	ForeignKey = "FOREIGN KEY"
+)
+
+// Constraint is a constraint of a table on one of its columns. Constraints
+// on several columns are made of one Constraint per column.
+type Constraint struct {
+	Name      string // Empty if the database does not name it.
+	Type      string // PrimaryKey, Unique or ForeignKey.
+	Column    string
+	Position  int // Position of the column in the constraint, starting at 1.
+	RefSchema string
+	RefTable  string
+	RefColumn string
+}
+
+var (
+	dialects = make(map[string]Dialect)
+
+	// aliases maps the other names of the drivers to their name
+	aliases = map[string]string{
+		"sqlite":     "sqlite3",
+		"postgresql": "postgres",
+	}
+)
+
+// Register makes a dialect available under the name of its driver
+func Register(d Dialect) {
+	if _, dup := dialects[d.Name()]; dup {
+		panic("dialect: Register called twice for " + d.Name())
+	}
+	dialects[d.Name()] = d
+}
+
+// Get returns the dialect of a driver, or an error listing
+// the supported drivers if there is none
+func Get(driver string) (Dialect, error) {
+	if name, ok := aliases[driver]; ok {
+		driver = name
+	}
+	if d, ok := dialects[driver]; ok {
+		return d, nil
+	}
+	return nil, fmt.Errorf("Unsupported database driver '%s'. Driver must be one of %s", driver, strings.Join(Names(), ", "))
+}
+
+// Names returns the names of the drivers of the registered dialects
+func Names() []string {
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsCurrentTimestamp reports whether the default value of a column is the current time
+func IsCurrentTimestamp(def string) bool {
+	def = strings.ToUpper(strings.TrimSpace(def))
+	return def == "CURRENT_TIMESTAMP" || def == "CURRENT_TIMESTAMP()" || def == "NOW()"
+}
+
+// parseFieldType splits a field type of "bee generate", e.g. "string:64", into its type and size
+func parseFieldType(fieldType string) (typ, size string) {
+	kv := strings.SplitN(fieldType, ":", 2)
+	if len(kv) == 2 {
+		return kv[0], kv[1]
+	}
+	return kv[0], ""
+}
+
+// unknownFieldType is the error of an unknown field type of "bee generate"
+func unknownFieldType(fieldType string) error {
+	return fmt.Errorf("unknown field type '%s'", fieldType)
+}
+
+// goType maps an SQL data type to a Go type
+func goType(mapping map[string]string, dataType string) (string, error) {
+	if v, ok := mapping[dataType]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("data type '%s' not found", dataType)
+}
+
+// quoteLiteral quotes a string literal of SQL
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// queryStrings returns the first column of the rows of a query
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// scanConstraints reads constraints from rows of the constraint name and type, the column name,
+// the referenced schema, table and column, and the position of the column
+func scanConstraints(rows *sql.Rows) ([]Constraint, error) {
+	var constraints []Constraint
+	for rows.Next() {
+		var name, constraintType, column, refSchema, refTable, refColumn, position []byte
+		if err := rows.Scan(&name, &constraintType, &column, &refSchema, &refTable, &refColumn, &position); err != nil {
+			return nil, err
+		}
+		pos, _ := strconv.Atoi(string(position))
+		constraints = append(constraints, Constraint{
+			Name:      string(name),
+			Type:      string(constraintType),
+			Column:    string(column),
+			Position:  pos,
+			RefSchema: string(refSchema),
+			RefTable:  string(refTable),
+			RefColumn: string(refColumn),
+		})
+	}
+	return constraints, rows.Err()
+}
+
+// scanIndexes reads indexes from rows of the index name, the column name, whether
+// the index is unique and whether it backs a constraint, ordered by index
+func scanIndexes(rows *sql.Rows) ([]Index, error) {
+	var indexes []Index
+	for rows.Next() {
+		var (
+			name, column       string
+			unique, constraint bool
+		)
+		if err := rows.Scan(&name, &column, &unique, &constraint); err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+			continue
+		}
+		indexes = append(indexes, Index{Name: name, Columns: []string{column}, Unique: unique, Constraint: constraint})
+	}
+	return indexes, rows.Err()
+}
+
+// addForeignKey returns the standard statement adding a foreign key constraint
+func addForeignKey(d Dialect, table, name, column, refTable, refColumn string) string {
+	return "ALTER TABLE " + d.Quote(table) + " ADD CONSTRAINT " + d.Quote(name) +
+		" FOREIGN KEY (" + d.Quote(column) + ") REFERENCES " + d.Quote(refTable) + " (" + d.Quote(refColumn) + ")"
+}
+
+// lockOwner identifies the process taking a lock which is not released with its
+// connection, as host:pid
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return host + ":" + strconv.Itoa(os.Getpid())
+}
+
+// isStaleOwner reports whether the owner of a lock is a process of this host
+// which is not running anymore
+func isStaleOwner(owner string) bool {
+	i := strings.LastIndex(owner, ":")
+	if i < 0 {
+		return false
+	}
+	host, _ := os.Hostname()
+	pid, err := strconv.Atoi(owner[i+1:])
+	if owner[:i] != host || err != nil {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return true
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess fails for the processes which are not running
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err != nil && err != syscall.EPERM
+}
@@ -0,0 +1,257 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package dialect
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	Register(mysql{})
+}
+
+// typeMappingMysql maps SQL data type to corresponding Go data type
+var typeMappingMysql = map[string]string{
+	"int":                "int", // int signed
+	"integer":            "int",
+	"tinyint":            "int8",
+	"smallint":           "int16",
+	"mediumint":          "int32",
+	"bigint":             "int64",
+	"int unsigned":       "uint", // int unsigned
+	"integer unsigned":   "uint",
+	"tinyint unsigned":   "uint8",
+	"smallint unsigned":  "uint16",
+	"mediumint unsigned": "uint32",
+	"bigint unsigned":    "uint64",
+	"bit":                "uint64",
+	"bool":               "bool",   // boolean
+	"enum":               "string", // enum
+	"set":                "string", // set
+	"varchar":            "string", // string & text
+	"char":               "string",
+	"tinytext":           "string",
+	"mediumtext":         "string",
+	"text":               "string",
+	"longtext":           "string",
+	"blob":               "string", // blob
+	"tinyblob":           "string",
+	"mediumblob":         "string",
+	"longblob":           "string",
+	"date":               "time.Time", // time
+	"datetime":           "time.Time",
+	"timestamp":          "time.Time",
+	"time":               "time.Time",
+	"float":              "float32", // float & decimal
+	"double":             "float64",
+	"decimal":            "float64",
+	"binary":             "string", // binary
+	"varbinary":          "string",
+	"year":               "int16",
+}
+
+// mysql is the dialect of MySQL
+type mysql struct{}
+
+func (mysql) Name() string { return "mysql" }
+
+func (mysql) DriverPackage() string { return "github.com/go-sql-driver/mysql" }
+
+func (mysql) DefaultConn() string { return "root:@tcp(127.0.0.1:3306)/test" }
+
+func (mysql) Quote(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func (mysql) Placeholder(int) string { return "?" }
+
+func (mysql) BackslashEscapes() bool { return true }
+
+func (mysql) MigrationsTableDDL() string {
+	return `
+CREATE TABLE migrations (
+	id_migration int(10) unsigned NOT NULL AUTO_INCREMENT COMMENT 'surrogate key',
+	name varchar(255) DEFAULT NULL COMMENT 'migration name, unique',
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT 'date migrated or rolled back',
+	statements longtext COMMENT 'SQL statements for this migration',
+	rollback_statements longtext COMMENT 'SQL statment for rolling back migration',
+	checksum varchar(64) DEFAULT NULL COMMENT 'SHA-256 of the migration file when applied',
+	status ENUM('update', 'rollback') COMMENT 'update indicates it is a normal migration while rollback means this migration is rolled back',
+	PRIMARY KEY (id_migration)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8
+`
+}
+
+func (mysql) MigrationsChecksumDDL() string {
+	return "ALTER TABLE migrations ADD COLUMN checksum varchar(64) DEFAULT NULL COMMENT 'SHA-256 of the migration file when applied'"
+}
+
+func (mysql) TryLock(db *sql.DB) (string, error) {
+	var locked sql.NullInt64
+	if err := db.QueryRow("SELECT GET_LOCK(?, 0)", lockName).Scan(&locked); err != nil {
+		return "", err
+	}
+	if locked.Int64 == 1 {
+		return "", nil
+	}
+	var holder sql.NullInt64
+	if err := db.QueryRow("SELECT IS_USED_LOCK(?)", lockName).Scan(&holder); err != nil || !holder.Valid {
+		return "another connection", err
+	}
+	return "connection " + strconv.FormatInt(holder.Int64, 10), nil
+}
+
+func (mysql) Unlock(db *sql.DB) error {
+	var released sql.NullInt64
+	return db.QueryRow("SELECT RELEASE_LOCK(?)", lockName).Scan(&released)
+}
+
+func (mysql) Tables(db *sql.DB) ([]string, error) {
+	return queryStrings(db, "SHOW TABLES")
+}
+
+func (mysql) Columns(db *sql.DB, table string) ([]Column, error) {
+	rows, err := db.Query(
+		`SELECT
+			column_name, data_type, column_type, is_nullable, column_default, column_key, extra, column_comment
+		FROM
+			information_schema.columns
+		WHERE
+			table_schema = database() AND table_name = ?
+		ORDER BY
+			ordinal_position`,
+		table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []Column
+	for rows.Next() {
+		// Bytes so that SQL <null> values can be retrieved
+		var name, dataType, columnType, isNullable, columnDefault, columnKey, extra, comment []byte
+		if err := rows.Scan(&name, &dataType, &columnType, &isNullable, &columnDefault, &columnKey, &extra, &comment); err != nil {
+			return nil, err
+		}
+		columns = append(columns, Column{
+			Name:          string(name),
+			DataType:      strings.ToLower(string(dataType)),
+			ColumnType:    strings.ToLower(string(columnType)),
+			Nullable:      string(isNullable) == "YES",
+			Default:       string(columnDefault),
+			PrimaryKey:    string(columnKey) == "PRI",
+			AutoIncrement: strings.Contains(string(extra), "auto_increment"),
+			AutoNow:       strings.Contains(strings.ToLower(string(extra)), "on update current_timestamp"),
+			Comment:       string(comment),
+		})
+	}
+	return columns, rows.Err()
+}
+
+func (mysql) Constraints(db *sql.DB, table string) ([]Constraint, error) {
+	rows, err := db.Query(
+		`SELECT
+			c.constraint_name, c.constraint_type, u.column_name, u.referenced_table_schema, u.referenced_table_name, referenced_column_name, u.ordinal_position
+		FROM
+			information_schema.table_constraints c
+		INNER JOIN
+			information_schema.key_column_usage u ON c.constraint_name = u.constraint_name
+		WHERE
+			c.table_schema = database() AND c.table_name = ? AND u.table_schema = database() AND u.table_name = ?`,
+		table, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanConstraints(rows)
+}
+
+func (mysql) ColumnType(fieldType string) (string, string, error) {
+	typ, size := parseFieldType(fieldType)
+	switch typ {
+	case "string":
+		if size != "" {
+			return "varchar(" + size + ") NOT NULL", "", nil
+		}
+		return "varchar(128) NOT NULL", "", nil
+	case "text":
+		return "longtext  NOT NULL", "", nil
+	case "auto":
+		return "int(11) NOT NULL AUTO_INCREMENT", "", nil
+	case "pk":
+		return "int(11) NOT NULL", "PRIMARY KEY (%s)", nil
+	case "datetime":
+		return "datetime NOT NULL", "", nil
+	case "int", "int8", "int16", "int32", "int64":
+		fallthrough
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		return "int(11) DEFAULT NULL", "", nil
+	case "bool":
+		return "tinyint(1) NOT NULL", "", nil
+	case "float32", "float64", "float":
+		return "float NOT NULL", "", nil
+	}
+	return "", "", unknownFieldType(fieldType)
+}
+
+func (d mysql) IDColumn() string {
+	return d.Quote("id") + " int(11) NOT NULL AUTO_INCREMENT PRIMARY KEY"
+}
+
+func (mysql) GoType(dataType string) (string, error) {
+	return goType(typeMappingMysql, dataType)
+}
+
+func (mysql) Indexes(db *sql.DB, table string) ([]Index, error) {
+	rows, err := db.Query(
+		`SELECT
+			index_name, column_name, non_unique = 0, 0
+		FROM
+			information_schema.statistics
+		WHERE
+			table_schema = database() AND table_name = ? AND index_name <> 'PRIMARY'
+		ORDER BY
+			index_name, seq_in_index`,
+		table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanIndexes(rows)
+}
+
+func (d mysql) ModifyColumn(table string, c ColumnDef) ([]string, error) {
+	return []string{"ALTER TABLE " + d.Quote(table) + " MODIFY COLUMN " + ColumnSQL(d, c)}, nil
+}
+
+func (d mysql) AddForeignKey(table, name, column, refTable, refColumn string) (string, error) {
+	return addForeignKey(d, table, name, column, refTable, refColumn), nil
+}
+
+func (d mysql) DropForeignKey(table, name string) (string, error) {
+	return "ALTER TABLE " + d.Quote(table) + " DROP FOREIGN KEY " + d.Quote(name), nil
+}
+
+func (d mysql) DropIndex(table, name string) string {
+	return "DROP INDEX " + d.Quote(name) + " ON " + d.Quote(table)
+}
+
+// MySQL moves the auto-increment counter past the values inserted explicitly
+
+func (mysql) SyncSequence(table, column string) string { return "" }
@@ -0,0 +1,306 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package dialect
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	Register(sqlite{})
+}
+
+// typeMappingSqlite maps the declared types of SQLite columns to Go types.
+// SQLite accepts any declared type, only the common ones are known.
+var typeMappingSqlite = map[string]string{
+	"integer":           "int", // int
+	"int":               "int",
+	"tinyint":           "int8",
+	"smallint":          "int16",
+	"mediumint":         "int32",
+	"bigint":            "int64",
+	"boolean":           "bool", // bool
+	"bool":              "bool",
+	"varchar":           "string", // string
+	"char":              "string",
+	"character":         "string",
+	"varying character": "string",
+	"nchar":             "string",
+	"nvarchar":          "string",
+	"text":              "string",
+	"clob":              "string",
+	"blob":              "string",    // binary
+	"date":              "time.Time", // time
+	"datetime":          "time.Time",
+	"timestamp":         "time.Time",
+	"time":              "time.Time",
+	"real":              "float64", // float & decimal
+	"double":            "float64",
+	"double precision":  "float64",
+	"float":             "float64",
+	"numeric":           "float64",
+	"decimal":           "float64",
+}
+
+// sqlite is the dialect of SQLite
+type sqlite struct{}
+
+func (sqlite) Name() string { return "sqlite3" }
+
+func (sqlite) DriverPackage() string { return "github.com/mattn/go-sqlite3" }
+
+func (sqlite) DefaultConn() string { return "database/dev.db" }
+
+func (sqlite) Quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (sqlite) Placeholder(int) string { return "?" }
+
+func (sqlite) BackslashEscapes() bool { return false }
+
+func (sqlite) MigrationsTableDDL() string {
+	return `
+CREATE TABLE migrations (
+	id_migration integer PRIMARY KEY AUTOINCREMENT,
+	name varchar(255) DEFAULT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	statements text,
+	rollback_statements text,
+	checksum varchar(64) DEFAULT NULL,
+	status varchar(8) CHECK (status IN ('update', 'rollback'))
+)`
+}
+
+func (sqlite) MigrationsChecksumDDL() string {
+	return "ALTER TABLE migrations ADD COLUMN checksum varchar(64) DEFAULT NULL"
+}
+
+// TryLock inserts the row of the migrations_lock table, SQLite having no lock
+// of its own lasting between transactions. The row of a process of this host
+// which exited without deleting it is taken over.
+func (sqlite) TryLock(db *sql.DB) (string, error) {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS migrations_lock (
+	id integer PRIMARY KEY CHECK (id = 1),
+	owner varchar(255) NOT NULL,
+	locked_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	if err != nil {
+		return "", err
+	}
+	for {
+		res, err := db.Exec("INSERT OR IGNORE INTO migrations_lock (id, owner) VALUES (1, ?)", lockOwner())
+		if err != nil {
+			return "", err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return "", nil
+		}
+		var owner, lockedAt string
+		err = db.QueryRow("SELECT owner, locked_at FROM migrations_lock WHERE id = 1").Scan(&owner, &lockedAt)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if !isStaleOwner(owner) {
+			return owner + " since " + lockedAt, nil
+		}
+		if _, err := db.Exec("DELETE FROM migrations_lock WHERE id = 1 AND owner = ?", owner); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (sqlite) Unlock(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM migrations_lock WHERE id = 1 AND owner = ?", lockOwner())
+	return err
+}
+
+func (sqlite) Tables(db *sql.DB) ([]string, error) {
+	return queryStrings(db, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+}
+
+func (sqlite) Columns(db *sql.DB, table string) ([]Column, error) {
+	rows, err := db.Query(`SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []Column
+	for rows.Next() {
+		var (
+			name, typ string
+			notNull   bool
+			def       sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&name, &typ, &notNull, &def, &pk); err != nil {
+			return nil, err
+		}
+		columnType := strings.ToLower(typ)
+		dataType := columnType
+		if i := strings.Index(dataType, "("); i >= 0 {
+			dataType = strings.TrimSpace(dataType[:i])
+		}
+		columns = append(columns, Column{
+			Name:       name,
+			DataType:   dataType,
+			ColumnType: columnType,
+			Nullable:   !notNull && pk == 0,
+			Default:    strings.Trim(def.String, "'"),
+			PrimaryKey: pk > 0,
+			// An integer primary key is the rowid
+			AutoIncrement: pk > 0 && dataType == "integer",
+		})
+	}
+	return columns, rows.Err()
+}
+
+func (d sqlite) Constraints(db *sql.DB, table string) ([]Constraint, error) {
+	var constraints []Constraint
+
+	columns, err := d.Columns(db, table)
+	if err != nil {
+		return nil, err
+	}
+	pks := 0
+	for _, c := range columns {
+		if c.PrimaryKey {
+			pks++
+			constraints = append(constraints, Constraint{Type: PrimaryKey, Column: c.Name, Position: pks})
+		}
+	}
+
+	rows, err := db.Query(`SELECT "from", "table", "to", seq FROM pragma_foreign_key_list(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			column, refTable string
+			refColumn        sql.NullString // Primary key of the referenced table if not set.
+			seq              int
+		)
+		if err := rows.Scan(&column, &refTable, &refColumn, &seq); err != nil {
+			return nil, err
+		}
+		if !refColumn.Valid {
+			refColumn.String = "id"
+		}
+		constraints = append(constraints, Constraint{
+			Type:      ForeignKey,
+			Column:    column,
+			Position:  seq + 1,
+			RefSchema: "main",
+			RefTable:  refTable,
+			RefColumn: refColumn.String,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	uniques, err := queryStrings(db,
+		`SELECT ii.name FROM pragma_index_list(?) il, pragma_index_info(il.name) ii WHERE il."unique" = 1 AND il.origin = 'u'`,
+		table)
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range uniques {
+		constraints = append(constraints, Constraint{Type: Unique, Column: column, Position: 1})
+	}
+	return constraints, nil
+}
+
+func (sqlite) ColumnType(fieldType string) (string, string, error) {
+	typ, size := parseFieldType(fieldType)
+	switch typ {
+	case "string":
+		if size != "" {
+			return "varchar(" + size + ") NOT NULL", "", nil
+		}
+		return "varchar(128) NOT NULL", "", nil
+	case "text":
+		return "text NOT NULL", "", nil
+	case "auto":
+		// The rowid, which must be an integer primary key
+		return "integer PRIMARY KEY AUTOINCREMENT", "", nil
+	case "pk":
+		return "integer PRIMARY KEY", "", nil
+	case "datetime":
+		return "datetime NOT NULL", "", nil
+	case "int", "int8", "int16", "int32", "int64":
+		fallthrough
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		return "integer DEFAULT NULL", "", nil
+	case "bool":
+		return "boolean NOT NULL", "", nil
+	case "float32", "float64", "float":
+		return "real NOT NULL", "", nil
+	}
+	return "", "", unknownFieldType(fieldType)
+}
+
+func (d sqlite) IDColumn() string {
+	return d.Quote("id") + " integer PRIMARY KEY AUTOINCREMENT"
+}
+
+func (sqlite) GoType(dataType string) (string, error) {
+	return goType(typeMappingSqlite, dataType)
+}
+
+func (sqlite) Indexes(db *sql.DB, table string) ([]Index, error) {
+	rows, err := db.Query(
+		`SELECT il.name, ii.name, il."unique", il.origin <> 'c'
+		FROM pragma_index_list(?) il, pragma_index_info(il.name) ii
+		WHERE il.origin <> 'pk'
+		ORDER BY il.name, ii.seqno`,
+		table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanIndexes(rows)
+}
+
+// SQLite only alters the columns and the constraints of a table by rebuilding it
+
+func (sqlite) ModifyColumn(table string, c ColumnDef) ([]string, error) {
+	return nil, fmt.Errorf("SQLite cannot alter column '%s' of '%s', the table must be rebuilt", c.Name, table)
+}
+
+func (sqlite) AddForeignKey(table, name, column, refTable, refColumn string) (string, error) {
+	return "", fmt.Errorf("SQLite cannot add a foreign key on '%s' to '%s', the table must be rebuilt", column, table)
+}
+
+func (sqlite) DropForeignKey(table, name string) (string, error) {
+	return "", fmt.Errorf("SQLite cannot drop a foreign key of '%s', the table must be rebuilt", table)
+}
+
+func (d sqlite) DropIndex(table, name string) string {
+	return "DROP INDEX " + d.Quote(name)
+}
+
+// SQLite moves the sequence of sqlite_sequence past the values inserted explicitly
+
+func (sqlite) SyncSequence(table, column string) string { return "" }
@@ -22,3 +22,5 @@ var Level utils.DocValue
 var Tables utils.DocValue
 var Fields utils.DocValue
 var DDL utils.DocValue
+var SQLFiles bool
+var Diff bool
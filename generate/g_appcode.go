@@ -23,11 +23,10 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/ClearGrass/qpbee/dialect"
 	beeLogger "github.com/ClearGrass/qpbee/logger"
 	"github.com/ClearGrass/qpbee/logger/colors"
 	"github.com/ClearGrass/qpbee/utils"
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/lib/pq"
 )
 
 const (
@@ -36,108 +35,12 @@ const (
 	ORouter
 )
 
-// DbTransformer has method to reverse engineer a database schema to restful api code
-type DbTransformer interface {
-	GetTableNames(conn *sql.DB) []string
-	GetConstraints(conn *sql.DB, table *Table, blackList map[string]bool)
-	GetColumns(conn *sql.DB, table *Table, blackList map[string]bool)
-	GetGoDataType(sqlType string) (string, error)
-}
-
-// MysqlDB is the MySQL version of DbTransformer
-type MysqlDB struct {
-}
-
-// PostgresDB is the PostgreSQL version of DbTransformer
-type PostgresDB struct {
-}
-
-// dbDriver maps a DBMS name to its version of DbTransformer
-var dbDriver = map[string]DbTransformer{
-	"mysql":    &MysqlDB{},
-	"postgres": &PostgresDB{},
-}
-
 type MvcPath struct {
 	ModelPath      string
 	ControllerPath string
 	RouterPath     string
 }
 
-// typeMapping maps SQL data type to corresponding Go data type
-var typeMappingMysql = map[string]string{
-	"int":                "int", // int signed
-	"integer":            "int",
-	"tinyint":            "int8",
-	"smallint":           "int16",
-	"mediumint":          "int32",
-	"bigint":             "int64",
-	"int unsigned":       "uint", // int unsigned
-	"integer unsigned":   "uint",
-	"tinyint unsigned":   "uint8",
-	"smallint unsigned":  "uint16",
-	"mediumint unsigned": "uint32",
-	"bigint unsigned":    "uint64",
-	"bit":                "uint64",
-	"bool":               "bool",   // boolean
-	"enum":               "string", // enum
-	"set":                "string", // set
-	"varchar":            "string", // string & text
-	"char":               "string",
-	"tinytext":           "string",
-	"mediumtext":         "string",
-	"text":               "string",
-	"longtext":           "string",
-	"blob":               "string", // blob
-	"tinyblob":           "string",
-	"mediumblob":         "string",
-	"longblob":           "string",
-	"date":               "time.Time", // time
-	"datetime":           "time.Time",
-	"timestamp":          "time.Time",
-	"time":               "time.Time",
-	"float":              "float32", // float & decimal
-	"double":             "float64",
-	"decimal":            "float64",
-	"binary":             "string", // binary
-	"varbinary":          "string",
-	"year":               "int16",
-}
-
-// typeMappingPostgres maps SQL data type to corresponding Go data type
-var typeMappingPostgres = map[string]string{
-	"serial":                      "int", // serial
-	"big serial":                  "int64",
-	"smallint":                    "int16", // int
-	"integer":                     "int",
-	"bigint":                      "int64",
-	"boolean":                     "bool",   // bool
-	"char":                        "string", // string
-	"character":                   "string",
-	"character varying":           "string",
-	"varchar":                     "string",
-	"text":                        "string",
-	"date":                        "time.Time", // time
-	"time":                        "time.Time",
-	"timestamp":                   "time.Time",
-	"timestamp without time zone": "time.Time",
-	"timestamp with time zone":    "time.Time",
-	"interval":                    "string",  // time interval, string for now
-	"real":                        "float32", // float & decimal
-	"double precision":            "float64",
-	"decimal":                     "float64",
-	"numeric":                     "float64",
-	"money":                       "float64", // money
-	"bytea":                       "string",  // binary
-	"tsvector":                    "string",  // fulltext
-	"ARRAY":                       "string",  // array
-	"USER-DEFINED":                "string",  // user defined
-	"uuid":                        "string",  // uuid
-	"json":                        "string",  // json
-	"jsonb":                       "string",  // jsonb
-	"inet":                        "string",  // ip address
-}
-
 // Table represent a table in a database
 type Table struct {
 	Name          string
@@ -282,67 +185,51 @@ func GenerateAppcode(driver, connStr, level, tables, currpath string) {
 			selectedTables[v] = true
 		}
 	}
-	switch driver {
-	case "mysql":
-	case "postgres":
-	case "sqlite":
-		beeLogger.Log.Fatal("Generating app code from SQLite database is not supported yet.")
-	default:
-		beeLogger.Log.Fatal("Unknown database driver. Must be either \"mysql\", \"postgres\" or \"sqlite\"")
+	d, err := dialect.Get(driver)
+	if err != nil {
+		beeLogger.Log.Fatalf("%s", err)
 	}
-	gen(driver, connStr, mode, selectedTables, currpath)
+	gen(d, connStr, mode, selectedTables, currpath)
 }
 
 // Generate takes table, column and foreign key information from database connection
 // and generate corresponding golang source files
-func gen(dbms, connStr string, mode byte, selectedTableNames map[string]bool, apppath string) {
-	db, err := sql.Open(dbms, connStr)
+func gen(d dialect.Dialect, connStr string, mode byte, selectedTableNames map[string]bool, apppath string) {
+	db, err := sql.Open(d.Name(), connStr)
 	if err != nil {
-		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", dbms, connStr, err)
+		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", d.Name(), connStr, err)
 	}
 	defer db.Close()
-	if trans, ok := dbDriver[dbms]; ok {
-		beeLogger.Log.Info("Analyzing database tables...")
-		var tableNames []string
-		if len(selectedTableNames) != 0 {
-			for tableName := range selectedTableNames {
-				tableNames = append(tableNames, tableName)
-			}
-		} else {
-			tableNames = trans.GetTableNames(db)
+	beeLogger.Log.Info("Analyzing database tables...")
+	var tableNames []string
+	if len(selectedTableNames) != 0 {
+		for tableName := range selectedTableNames {
+			tableNames = append(tableNames, tableName)
 		}
-		tables := getTableObjects(tableNames, db, trans)
-		mvcPath := new(MvcPath)
-		mvcPath.ModelPath = path.Join(apppath, "models")
-		mvcPath.ControllerPath = path.Join(apppath, "controllers")
-		mvcPath.RouterPath = path.Join(apppath, "routers")
-		createPaths(mode, mvcPath)
-		pkgPath := getPackagePath(apppath)
-		writeSourceFiles(pkgPath, tables, mode, mvcPath, selectedTableNames)
 	} else {
-		beeLogger.Log.Fatalf("Generating app code from '%s' database is not supported yet.", dbms)
+		tableNames = getTableNames(db, d)
 	}
+	tables := getTableObjects(tableNames, db, d)
+	mvcPath := new(MvcPath)
+	mvcPath.ModelPath = path.Join(apppath, "models")
+	mvcPath.ControllerPath = path.Join(apppath, "controllers")
+	mvcPath.RouterPath = path.Join(apppath, "routers")
+	createPaths(mode, mvcPath)
+	pkgPath := getPackagePath(apppath)
+	writeSourceFiles(pkgPath, tables, mode, mvcPath, selectedTableNames)
 }
 
-// GetTableNames returns a slice of table names in the current database
-func (*MysqlDB) GetTableNames(db *sql.DB) (tables []string) {
-	rows, err := db.Query("SHOW TABLES")
+// getTableNames returns a slice of table names in the current database
+func getTableNames(db *sql.DB, d dialect.Dialect) []string {
+	tables, err := d.Tables(db)
 	if err != nil {
 		beeLogger.Log.Fatalf("Could not show tables: %s", err)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			beeLogger.Log.Fatalf("Could not show tables: %s", err)
-		}
-		tables = append(tables, name)
-	}
-	return
+	return tables
 }
 
 // getTableObjects process each table name
-func getTableObjects(tableNames []string, db *sql.DB, dbTransformer DbTransformer) (tables []*Table) {
+func getTableObjects(tableNames []string, db *sql.DB, d dialect.Dialect) (tables []*Table) {
 	// if a table has a composite pk or doesn't have pk, we can't use it yet
 	// these tables will be put into blacklist so that other struct will not
 	// reference it.
@@ -353,110 +240,77 @@ func getTableObjects(tableNames []string, db *sql.DB, dbTransformer DbTransforme
 		tb := new(Table)
 		tb.Name = tableName
 		tb.Fk = make(map[string]*ForeignKey)
-		dbTransformer.GetConstraints(db, tb, blackList)
+		getConstraints(db, d, tb, blackList)
 		tables = append(tables, tb)
 	}
 	// process columns, ignoring blacklisted tables
 	for _, tb := range tables {
-		dbTransformer.GetColumns(db, tb, blackList)
+		getColumns(db, d, tb, blackList)
 	}
 	return
 }
 
-// GetConstraints gets primary key, unique key and foreign keys of a table from
-// information_schema and fill in the Table struct
-func (*MysqlDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
-	rows, err := db.Query(
-		`SELECT
-			c.constraint_type, u.column_name, u.referenced_table_schema, u.referenced_table_name, referenced_column_name, u.ordinal_position
-		FROM
-			information_schema.table_constraints c
-		INNER JOIN
-			information_schema.key_column_usage u ON c.constraint_name = u.constraint_name
-		WHERE
-			c.table_schema = database() AND c.table_name = ? AND u.table_schema = database() AND u.table_name = ?`,
-		table.Name, table.Name) //  u.position_in_unique_constraint,
+// getConstraints gets primary key, unique key and foreign keys of a table
+// and fill in the Table struct
+func getConstraints(db *sql.DB, d dialect.Dialect, table *Table, blackList map[string]bool) {
+	constraints, err := d.Constraints(db, table.Name)
 	if err != nil {
-		beeLogger.Log.Fatal("Could not query INFORMATION_SCHEMA for PK/UK/FK information")
+		beeLogger.Log.Fatalf("Could not query the PK/UK/FK information of '%s': %s", table.Name, err)
 	}
-	for rows.Next() {
-		var constraintTypeBytes, columnNameBytes, refTableSchemaBytes, refTableNameBytes, refColumnNameBytes, refOrdinalPosBytes []byte
-		if err := rows.Scan(&constraintTypeBytes, &columnNameBytes, &refTableSchemaBytes, &refTableNameBytes, &refColumnNameBytes, &refOrdinalPosBytes); err != nil {
-			beeLogger.Log.Fatal("Could not read INFORMATION_SCHEMA for PK/UK/FK information")
-		}
-		constraintType, columnName, refTableSchema, refTableName, refColumnName, refOrdinalPos :=
-			string(constraintTypeBytes), string(columnNameBytes), string(refTableSchemaBytes),
-			string(refTableNameBytes), string(refColumnNameBytes), string(refOrdinalPosBytes)
-		if constraintType == "PRIMARY KEY" {
-			if refOrdinalPos == "1" {
-				table.Pk = columnName
+	for _, c := range constraints {
+		switch c.Type {
+		case dialect.PrimaryKey:
+			if c.Position == 1 {
+				table.Pk = c.Column
 			} else {
 				table.Pk = ""
 				// Add table to blacklist so that other struct will not reference it, because we are not
 				// registering blacklisted tables
 				blackList[table.Name] = true
 			}
-		} else if constraintType == "UNIQUE" {
-			table.Uk = append(table.Uk, columnName)
-		} else if constraintType == "FOREIGN KEY" {
+		case dialect.Unique:
+			table.Uk = append(table.Uk, c.Column)
+		case dialect.ForeignKey:
 			fk := new(ForeignKey)
-			fk.Name = columnName
-			fk.RefSchema = refTableSchema
-			fk.RefTable = refTableName
-			fk.RefColumn = refColumnName
-			table.Fk[columnName] = fk
+			fk.Name = c.Column
+			fk.RefSchema = c.RefSchema
+			fk.RefTable = c.RefTable
+			fk.RefColumn = c.RefColumn
+			table.Fk[c.Column] = fk
 		}
 	}
 }
 
-// GetColumns retrieves columns details from
-// information_schema and fill in the Column struct
-func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
-	// retrieve columns
-	colDefRows, err := db.Query(
-		`SELECT
-			column_name, data_type, column_type, is_nullable, column_default, extra, column_comment 
-		FROM
-			information_schema.columns
-		WHERE
-			table_schema = database() AND table_name = ?`,
-		table.Name)
+// getColumns retrieves columns details and fill in the Column struct
+func getColumns(db *sql.DB, d dialect.Dialect, table *Table, blackList map[string]bool) {
+	columns, err := d.Columns(db, table.Name)
 	if err != nil {
-		beeLogger.Log.Fatalf("Could not query the database: %s", err)
+		beeLogger.Log.Fatalf("Could not query the column information of '%s': %s", table.Name, err)
 	}
-	defer colDefRows.Close()
-
-	for colDefRows.Next() {
-		// datatype as bytes so that SQL <null> values can be retrieved
-		var colNameBytes, dataTypeBytes, columnTypeBytes, isNullableBytes, columnDefaultBytes, extraBytes, columnCommentBytes []byte
-		if err := colDefRows.Scan(&colNameBytes, &dataTypeBytes, &columnTypeBytes, &isNullableBytes, &columnDefaultBytes, &extraBytes, &columnCommentBytes); err != nil {
-			beeLogger.Log.Fatal("Could not query INFORMATION_SCHEMA for column information")
-		}
-		colName, dataType, columnType, isNullable, columnDefault, extra, columnComment :=
-			string(colNameBytes), string(dataTypeBytes), string(columnTypeBytes), string(isNullableBytes), string(columnDefaultBytes), string(extraBytes), string(columnCommentBytes)
 
+	for _, c := range columns {
 		// create a column
 		col := new(Column)
-		col.Name = utils.CamelCase(colName)
-		col.Type, err = mysqlDB.GetGoDataType(dataType)
+		col.Name = utils.CamelCase(c.Name)
+		col.Type, err = d.GoType(c.DataType)
 		if err != nil {
 			beeLogger.Log.Fatalf("%s", err)
 		}
 
 		// Tag info
 		tag := new(OrmTag)
-		tag.Column = colName
-		tag.Comment = columnComment
-		if table.Pk == colName {
+		tag.Column = c.Name
+		tag.Comment = c.Comment
+		if table.Pk == c.Name {
 			col.Name = "Id"
 			col.Type = "int"
-			if extra == "auto_increment" {
+			if c.AutoIncrement {
 				tag.Auto = true
 			} else {
 				tag.Pk = true
 			}
 		} else {
-			fkCol, isFk := table.Fk[colName]
+			fkCol, isFk := table.Fk[c.Name]
 			isBl := false
 			if isFk {
 				_, isBl = blackList[fkCol.RefTable]
@@ -465,237 +319,44 @@ func (mysqlDB *MysqlDB) GetColumns(db *sql.DB, table *Table, blackList map[strin
 			if isFk && !isBl {
 				tag.RelFk = true
 				refStructName := fkCol.RefTable
-				col.Name = utils.CamelCase(colName)
+				col.Name = utils.CamelCase(c.Name)
 				col.Type = "*" + utils.CamelCase(refStructName)
 			} else {
 				// if the name of column is Id, and it's not primary key
-				if colName == "id" {
+				if c.Name == "id" {
 					col.Name = "Id_RENAME"
 				}
-				if isNullable == "YES" {
+				if c.Nullable {
 					tag.Null = true
 				}
-				if isSQLSignedIntType(dataType) {
-					sign := extractIntSignness(columnType)
-					if sign == "unsigned" && extra != "auto_increment" {
-						col.Type, err = mysqlDB.GetGoDataType(dataType + " " + sign)
-						if err != nil {
-							beeLogger.Log.Fatalf("%s", err)
-						}
-					}
-				}
-				if isSQLStringType(dataType) {
-					tag.Size = extractColSize(columnType)
-				}
-				if isSQLTemporalType(dataType) {
-					tag.Type = dataType
-					//check auto_now, auto_now_add
-					if columnDefault == "CURRENT_TIMESTAMP" && extra == "on update CURRENT_TIMESTAMP" {
-						tag.AutoNow = true
-					} else if columnDefault == "CURRENT_TIMESTAMP" {
-						tag.AutoNowAdd = true
+				if isSQLSignedIntType(c.DataType) && strings.Contains(c.ColumnType, "unsigned") && !c.AutoIncrement {
+					col.Type, err = d.GoType(c.DataType + " unsigned")
+					if err != nil {
+						beeLogger.Log.Fatalf("%s", err)
 					}
-					// need to import time package
-					table.ImportTimePkg = true
-				}
-				if isSQLDecimal(dataType) {
-					tag.Digits, tag.Decimals = extractDecimal(columnType)
-				}
-				if isSQLBinaryType(dataType) {
-					tag.Size = extractColSize(columnType)
-				}
-				if isSQLBitType(dataType) {
-					tag.Size = extractColSize(columnType)
-				}
-			}
-		}
-		col.Tag = tag
-		table.Columns = append(table.Columns, col)
-	}
-}
-
-// GetGoDataType maps an SQL data type to Golang data type
-func (*MysqlDB) GetGoDataType(sqlType string) (string, error) {
-	if v, ok := typeMappingMysql[sqlType]; ok {
-		return v, nil
-	}
-	return "", fmt.Errorf("data type '%s' not found", sqlType)
-}
-
-// GetTableNames for PostgreSQL
-func (*PostgresDB) GetTableNames(db *sql.DB) (tables []string) {
-	rows, err := db.Query(`
-		SELECT table_name FROM information_schema.tables
-		WHERE table_catalog = current_database() AND
-		table_type = 'BASE TABLE' AND
-		table_schema NOT IN ('pg_catalog', 'information_schema')`)
-	if err != nil {
-		beeLogger.Log.Fatalf("Could not show tables: %s", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			beeLogger.Log.Fatalf("Could not show tables: %s", err)
-		}
-		tables = append(tables, name)
-	}
-	return
-}
-
-// GetConstraints for PostgreSQL
-func (*PostgresDB) GetConstraints(db *sql.DB, table *Table, blackList map[string]bool) {
-	rows, err := db.Query(
-		`SELECT
-			c.constraint_type,
-			u.column_name,
-			cu.table_catalog AS referenced_table_catalog,
-			cu.table_name AS referenced_table_name,
-			cu.column_name AS referenced_column_name,
-			u.ordinal_position
-		FROM
-			information_schema.table_constraints c
-		INNER JOIN
-			information_schema.key_column_usage u ON c.constraint_name = u.constraint_name
-		INNER JOIN
-			information_schema.constraint_column_usage cu ON cu.constraint_name =  c.constraint_name
-		WHERE
-			c.table_catalog = current_database() AND c.table_schema NOT IN ('pg_catalog', 'information_schema')
-			 AND c.table_name = $1
-			AND u.table_catalog = current_database() AND u.table_schema NOT IN ('pg_catalog', 'information_schema')
-			 AND u.table_name = $2`,
-		table.Name, table.Name) //  u.position_in_unique_constraint,
-	if err != nil {
-		beeLogger.Log.Fatalf("Could not query INFORMATION_SCHEMA for PK/UK/FK information: %s", err)
-	}
-
-	for rows.Next() {
-		var constraintTypeBytes, columnNameBytes, refTableSchemaBytes, refTableNameBytes, refColumnNameBytes, refOrdinalPosBytes []byte
-		if err := rows.Scan(&constraintTypeBytes, &columnNameBytes, &refTableSchemaBytes, &refTableNameBytes, &refColumnNameBytes, &refOrdinalPosBytes); err != nil {
-			beeLogger.Log.Fatalf("Could not read INFORMATION_SCHEMA for PK/UK/FK information: %s", err)
-		}
-		constraintType, columnName, refTableSchema, refTableName, refColumnName, refOrdinalPos :=
-			string(constraintTypeBytes), string(columnNameBytes), string(refTableSchemaBytes),
-			string(refTableNameBytes), string(refColumnNameBytes), string(refOrdinalPosBytes)
-		if constraintType == "PRIMARY KEY" {
-			if refOrdinalPos == "1" {
-				table.Pk = columnName
-			} else {
-				table.Pk = ""
-				// add table to blacklist so that other struct will not reference it, because we are not
-				// registering blacklisted tables
-				blackList[table.Name] = true
-			}
-		} else if constraintType == "UNIQUE" {
-			table.Uk = append(table.Uk, columnName)
-		} else if constraintType == "FOREIGN KEY" {
-			fk := new(ForeignKey)
-			fk.Name = columnName
-			fk.RefSchema = refTableSchema
-			fk.RefTable = refTableName
-			fk.RefColumn = refColumnName
-			table.Fk[columnName] = fk
-		}
-	}
-}
-
-// GetColumns for PostgreSQL
-func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map[string]bool) {
-	// retrieve columns
-	colDefRows, err := db.Query(
-		`SELECT
-			column_name,
-			data_type,
-			data_type ||
-			CASE
-				WHEN data_type = 'character' THEN '('||character_maximum_length||')'
-				WHEN data_type = 'numeric' THEN '(' || numeric_precision || ',' || numeric_scale ||')'
-				ELSE ''
-			END AS column_type,
-			is_nullable,
-			column_default,
-			'' AS extra
-		FROM
-			information_schema.columns
-		WHERE
-			table_catalog = current_database() AND table_schema NOT IN ('pg_catalog', 'information_schema')
-			 AND table_name = $1`,
-		table.Name)
-	if err != nil {
-		beeLogger.Log.Fatalf("Could not query INFORMATION_SCHEMA for column information: %s", err)
-	}
-	defer colDefRows.Close()
-
-	for colDefRows.Next() {
-		// datatype as bytes so that SQL <null> values can be retrieved
-		var colNameBytes, dataTypeBytes, columnTypeBytes, isNullableBytes, columnDefaultBytes, extraBytes []byte
-		if err := colDefRows.Scan(&colNameBytes, &dataTypeBytes, &columnTypeBytes, &isNullableBytes, &columnDefaultBytes, &extraBytes); err != nil {
-			beeLogger.Log.Fatalf("Could not query INFORMATION_SCHEMA for column information: %s", err)
-		}
-		colName, dataType, columnType, isNullable, columnDefault, extra :=
-			string(colNameBytes), string(dataTypeBytes), string(columnTypeBytes), string(isNullableBytes), string(columnDefaultBytes), string(extraBytes)
-		// Create a column
-		col := new(Column)
-		col.Name = utils.CamelCase(colName)
-		col.Type, err = postgresDB.GetGoDataType(dataType)
-		if err != nil {
-			beeLogger.Log.Fatalf("%s", err)
-		}
-
-		// Tag info
-		tag := new(OrmTag)
-		tag.Column = colName
-		if table.Pk == colName {
-			col.Name = "Id"
-			col.Type = "int"
-			if extra == "auto_increment" {
-				tag.Auto = true
-			} else {
-				tag.Pk = true
-			}
-		} else {
-			fkCol, isFk := table.Fk[colName]
-			isBl := false
-			if isFk {
-				_, isBl = blackList[fkCol.RefTable]
-			}
-			// check if the current column is a foreign key
-			if isFk && !isBl {
-				tag.RelFk = true
-				refStructName := fkCol.RefTable
-				col.Name = utils.CamelCase(colName)
-				col.Type = "*" + utils.CamelCase(refStructName)
-			} else {
-				// if the name of column is Id, and it's not primary key
-				if colName == "id" {
-					col.Name = "Id_RENAME"
-				}
-				if isNullable == "YES" {
-					tag.Null = true
 				}
-				if isSQLStringType(dataType) {
-					tag.Size = extractColSize(columnType)
+				if isSQLStringType(c.DataType) {
+					tag.Size = extractColSize(c.ColumnType)
 				}
-				if isSQLTemporalType(dataType) || strings.HasPrefix(dataType, "timestamp") {
-					tag.Type = dataType
+				if isSQLTemporalType(c.DataType) || strings.HasPrefix(c.DataType, "timestamp") {
+					tag.Type = c.DataType
 					//check auto_now, auto_now_add
-					if columnDefault == "CURRENT_TIMESTAMP" && extra == "on update CURRENT_TIMESTAMP" {
+					if c.AutoNow {
 						tag.AutoNow = true
-					} else if columnDefault == "CURRENT_TIMESTAMP" {
+					} else if dialect.IsCurrentTimestamp(c.Default) {
 						tag.AutoNowAdd = true
 					}
 					// need to import time package
 					table.ImportTimePkg = true
 				}
-				if isSQLDecimal(dataType) {
-					tag.Digits, tag.Decimals = extractDecimal(columnType)
+				if isSQLDecimal(c.DataType) {
+					tag.Digits, tag.Decimals = extractDecimal(c.ColumnType)
 				}
-				if isSQLBinaryType(dataType) {
-					tag.Size = extractColSize(columnType)
+				if isSQLBinaryType(c.DataType) || isSQLBitType(c.DataType) {
+					tag.Size = extractColSize(c.ColumnType)
 				}
-				if isSQLStrangeType(dataType) {
-					tag.Type = dataType
+				if isSQLStrangeType(c.DataType) {
+					tag.Type = c.DataType
 				}
 			}
 		}
@@ -704,14 +365,6 @@ func (postgresDB *PostgresDB) GetColumns(db *sql.DB, table *Table, blackList map
 	}
 }
 
-// GetGoDataType returns the Go type from the mapped Postgres type
-func (*PostgresDB) GetGoDataType(sqlType string) (string, error) {
-	if v, ok := typeMappingPostgres[sqlType]; ok {
-		return v, nil
-	}
-	return "", fmt.Errorf("data type '%s' not found", sqlType)
-}
-
 // deleteAndRecreatePaths removes several directories completely
 func createPaths(mode byte, paths *MvcPath) {
 	if (mode & OModel) == OModel {
@@ -933,19 +586,16 @@ func isSQLStrangeType(t string) bool {
 	return t == "interval" || t == "uuid" || t == "json"
 }
 
-// extractColSize extracts field size: e.g. varchar(255) => 255
+// extractColSize extracts field size: e.g. varchar(255) => 255, empty if there is none
 func extractColSize(colType string) string {
 	regex := regexp.MustCompile(`^[a-z]+\(([0-9]+)\)$`)
 	size := regex.FindStringSubmatch(colType)
+	if size == nil {
+		return ""
+	}
 	return size[1]
 }
 
-func extractIntSignness(colType string) string {
-	regex := regexp.MustCompile(`(int|smallint|mediumint|bigint)\([0-9]+\)(.*)`)
-	signRegex := regex.FindStringSubmatch(colType)
-	return strings.Trim(signRegex[2], " ")
-}
-
 func extractDecimal(colType string) (digits string, decimals string) {
 	decimalRegex := regexp.MustCompile(`decimal\(([0-9]+),([0-9]+)\)`)
 	decimal := decimalRegex.FindStringSubmatch(colType)
@@ -964,6 +614,12 @@ func getFileName(tbName string) (filename string) {
 }
 
 func getPackagePath(curpath string) (packpath string) {
+	// Applications living in a Go module take their import path from go.mod
+	if modPackPath, ok := utils.GetModulePackagePath(curpath); ok {
+		beeLogger.Log.Debugf("Module package path: %s", utils.FILE(), utils.LINE(), modPackPath)
+		return modPackPath
+	}
+
 	gopath := os.Getenv("GOPATH")
 	if gopath == "" {
 		beeLogger.Log.Fatal("GOPATH environment variable is not set or empty")
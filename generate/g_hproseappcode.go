@@ -24,11 +24,10 @@ import (
 	"path"
 	"strings"
 
+	"github.com/ClearGrass/qpbee/dialect"
 	beeLogger "github.com/ClearGrass/qpbee/logger"
 	"github.com/ClearGrass/qpbee/logger/colors"
 	"github.com/ClearGrass/qpbee/utils"
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/lib/pq"
 )
 
 var Hproseconf = `appname = {{.Appname}}
@@ -292,37 +291,29 @@ func GenerateHproseAppcode(driver, connStr, level, tables, currpath string) {
 			selectedTables[v] = true
 		}
 	}
-	switch driver {
-	case "mysql":
-	case "postgres":
-	case "sqlite":
-		beeLogger.Log.Fatal("Generating app code from SQLite database is not supported yet")
-	default:
-		beeLogger.Log.Fatalf("Unknown database driver '%s'. Driver must be one of mysql, postgres or sqlite", driver)
+	d, err := dialect.Get(driver)
+	if err != nil {
+		beeLogger.Log.Fatalf("%s", err)
 	}
-	genHprose(driver, connStr, mode, selectedTables, currpath)
+	genHprose(d, connStr, mode, selectedTables, currpath)
 }
 
 // Generate takes table, column and foreign key information from database connection
 // and generate corresponding golang source files
-func genHprose(dbms, connStr string, mode byte, selectedTableNames map[string]bool, currpath string) {
-	db, err := sql.Open(dbms, connStr)
+func genHprose(d dialect.Dialect, connStr string, mode byte, selectedTableNames map[string]bool, currpath string) {
+	db, err := sql.Open(d.Name(), connStr)
 	if err != nil {
-		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", dbms, connStr, err)
+		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", d.Name(), connStr, err)
 	}
 	defer db.Close()
-	if trans, ok := dbDriver[dbms]; ok {
-		beeLogger.Log.Info("Analyzing database tables...")
-		tableNames := trans.GetTableNames(db)
-		tables := getTableObjects(tableNames, db, trans)
-		mvcPath := new(MvcPath)
-		mvcPath.ModelPath = path.Join(currpath, "models")
-		createPaths(mode, mvcPath)
-		pkgPath := getPackagePath(currpath)
-		writeHproseSourceFiles(pkgPath, tables, mode, mvcPath, selectedTableNames)
-	} else {
-		beeLogger.Log.Fatalf("Generating app code from '%s' database is not supported yet", dbms)
-	}
+	beeLogger.Log.Info("Analyzing database tables...")
+	tableNames := getTableNames(db, d)
+	tables := getTableObjects(tableNames, db, d)
+	mvcPath := new(MvcPath)
+	mvcPath.ModelPath = path.Join(currpath, "models")
+	createPaths(mode, mvcPath)
+	pkgPath := getPackagePath(currpath)
+	writeHproseSourceFiles(pkgPath, tables, mode, mvcPath, selectedTableNames)
 }
 
 // writeHproseSourceFiles generates source files for model/controller/router
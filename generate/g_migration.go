@@ -18,9 +18,11 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ClearGrass/qpbee/dialect"
 	"github.com/ClearGrass/qpbee/logger"
 	"github.com/ClearGrass/qpbee/logger/colors"
 	"github.com/ClearGrass/qpbee/utils"
@@ -32,93 +34,38 @@ const (
 	DBPath      = "database"
 )
 
+// DBDriver generates the SQL of the migrations of "bee generate migration -fields"
 type DBDriver interface {
 	GenerateCreateUp(tableName string) string
 	GenerateCreateDown(tableName string) string
+	CreateTableSQL(tableName string) string
+	DropTableSQL(tableName string) string
 }
 
-type mysqlDriver struct{}
+// migrationDriver generates the SQL of the migrations in an SQL dialect
+type migrationDriver struct {
+	d dialect.Dialect
+}
 
-func (m mysqlDriver) GenerateCreateUp(tableName string) string {
-	upsql := `m.SQL("CREATE TABLE ` + tableName + "(" + m.generateSQLFromFields(Fields.String()) + `)");`
+func (m migrationDriver) GenerateCreateUp(tableName string) string {
+	upsql := `m.SQL(` + strconv.Quote(m.CreateTableSQL(tableName)) + `);`
 	return upsql
 }
 
-func (m mysqlDriver) GenerateCreateDown(tableName string) string {
-	downsql := `m.SQL("DROP TABLE ` + "`" + tableName + "`" + `")`
+func (m migrationDriver) GenerateCreateDown(tableName string) string {
+	downsql := `m.SQL(` + strconv.Quote(m.DropTableSQL(tableName)) + `)`
 	return downsql
 }
 
-func (m mysqlDriver) generateSQLFromFields(fields string) string {
-	sql, tags := "", ""
-	fds := strings.Split(fields, ",")
-	for i, v := range fds {
-		kv := strings.SplitN(v, ":", 2)
-		if len(kv) != 2 {
-			beeLogger.Log.Error("Fields format is wrong. Should be: key:type,key:type " + v)
-			return ""
-		}
-		typ, tag := m.getSQLType(kv[1])
-		if typ == "" {
-			beeLogger.Log.Error("Fields format is wrong. Should be: key:type,key:type " + v)
-			return ""
-		}
-		if i == 0 && strings.ToLower(kv[0]) != "id" {
-			sql += "`id` int(11) NOT NULL AUTO_INCREMENT,"
-			tags = tags + "PRIMARY KEY (`id`),"
-		}
-		sql += "`" + utils.SnakeString(kv[0]) + "` " + typ + ","
-		if tag != "" {
-			tags = tags + fmt.Sprintf(tag, "`"+utils.SnakeString(kv[0])+"`") + ","
-		}
-	}
-	sql = strings.TrimRight(sql+tags, ",")
-	return sql
+func (m migrationDriver) CreateTableSQL(tableName string) string {
+	return "CREATE TABLE " + m.d.Quote(tableName) + "(" + m.generateSQLFromFields(Fields.String()) + ")"
 }
 
-func (m mysqlDriver) getSQLType(ktype string) (tp, tag string) {
-	kv := strings.SplitN(ktype, ":", 2)
-	switch kv[0] {
-	case "string":
-		if len(kv) == 2 {
-			return "varchar(" + kv[1] + ") NOT NULL", ""
-		}
-		return "varchar(128) NOT NULL", ""
-	case "text":
-		return "longtext  NOT NULL", ""
-	case "auto":
-		return "int(11) NOT NULL AUTO_INCREMENT", ""
-	case "pk":
-		return "int(11) NOT NULL", "PRIMARY KEY (%s)"
-	case "datetime":
-		return "datetime NOT NULL", ""
-	case "int", "int8", "int16", "int32", "int64":
-		fallthrough
-	case "uint", "uint8", "uint16", "uint32", "uint64":
-		return "int(11) DEFAULT NULL", ""
-	case "bool":
-		return "tinyint(1) NOT NULL", ""
-	case "float32", "float64":
-		return "float NOT NULL", ""
-	case "float":
-		return "float NOT NULL", ""
-	}
-	return "", ""
+func (m migrationDriver) DropTableSQL(tableName string) string {
+	return "DROP TABLE " + m.d.Quote(tableName)
 }
 
-type postgresqlDriver struct{}
-
-func (m postgresqlDriver) GenerateCreateUp(tableName string) string {
-	upsql := `m.SQL("CREATE TABLE ` + tableName + "(" + m.generateSQLFromFields(Fields.String()) + `)");`
-	return upsql
-}
-
-func (m postgresqlDriver) GenerateCreateDown(tableName string) string {
-	downsql := `m.SQL("DROP TABLE ` + tableName + `")`
-	return downsql
-}
-
-func (m postgresqlDriver) generateSQLFromFields(fields string) string {
+func (m migrationDriver) generateSQLFromFields(fields string) string {
 	sql, tags := "", ""
 	fds := strings.Split(fields, ",")
 	for i, v := range fds {
@@ -127,63 +74,31 @@ func (m postgresqlDriver) generateSQLFromFields(fields string) string {
 			beeLogger.Log.Error("Fields format is wrong. Should be: key:type,key:type " + v)
 			return ""
 		}
-		typ, tag := m.getSQLType(kv[1])
-		if typ == "" {
+		typ, tag, err := m.d.ColumnType(kv[1])
+		if err != nil {
 			beeLogger.Log.Error("Fields format is wrong. Should be: key:type,key:type " + v)
 			return ""
 		}
 		if i == 0 && strings.ToLower(kv[0]) != "id" {
-			sql += "id serial primary key,"
+			sql += m.d.IDColumn() + ","
 		}
-		sql += utils.SnakeString(kv[0]) + " " + typ + ","
+		column := m.d.Quote(utils.SnakeString(kv[0]))
+		sql += column + " " + typ + ","
 		if tag != "" {
-			tags = tags + fmt.Sprintf(tag, utils.SnakeString(kv[0])) + ","
+			tags = tags + fmt.Sprintf(tag, column) + ","
 		}
 	}
-	if tags != "" {
-		sql = strings.TrimRight(sql+" "+tags, ",")
-	} else {
-		sql = strings.TrimRight(sql, ",")
-	}
+	sql = strings.TrimRight(sql+tags, ",")
 	return sql
 }
 
-func (m postgresqlDriver) getSQLType(ktype string) (tp, tag string) {
-	kv := strings.SplitN(ktype, ":", 2)
-	switch kv[0] {
-	case "string":
-		if len(kv) == 2 {
-			return "char(" + kv[1] + ") NOT NULL", ""
-		}
-		return "TEXT NOT NULL", ""
-	case "text":
-		return "TEXT NOT NULL", ""
-	case "auto", "pk":
-		return "serial primary key", ""
-	case "datetime":
-		return "TIMESTAMP WITHOUT TIME ZONE NOT NULL", ""
-	case "int", "int8", "int16", "int32", "int64":
-		fallthrough
-	case "uint", "uint8", "uint16", "uint32", "uint64":
-		return "integer DEFAULT NULL", ""
-	case "bool":
-		return "boolean NOT NULL", ""
-	case "float32", "float64", "float":
-		return "numeric NOT NULL", ""
-	}
-	return "", ""
-}
-
+// NewDBDriver returns the generator of the SQL of the migrations for the SQLDriver
 func NewDBDriver() DBDriver {
-	switch SQLDriver {
-	case "mysql":
-		return mysqlDriver{}
-	case "postgres":
-		return postgresqlDriver{}
-	default:
-		beeLogger.Log.Fatal("Driver not supported")
-		return nil
+	d, err := dialect.Get(SQLDriver.String())
+	if err != nil {
+		beeLogger.Log.Fatalf("%s", err)
 	}
+	return migrationDriver{d}
 }
 
 // generateMigration generates migration file template for database schema update.
@@ -235,6 +150,37 @@ func GenerateMigration(mname, upsql, downsql, curpath string) {
 	}
 }
 
+// GenerateSQLMigration generates a migration as a pair of SQL files, <time>_<name>.up.sql
+// updating the schema and <time>_<name>.down.sql reverting the update, which
+// "bee migrate" runs without building them.
+func GenerateSQLMigration(mname, upsql, downsql, curpath string) {
+	w := colors.NewColorWriter(os.Stdout)
+	migrationFilePath := path.Join(curpath, DBPath, MPath)
+	if err := os.MkdirAll(migrationFilePath, 0777); err != nil {
+		beeLogger.Log.Fatalf("Could not create migration directory: %s", err)
+	}
+	today := time.Now().Format(MDateFormat)
+	if upsql == "" {
+		upsql = "-- SQL statements updating the schema, separated by semicolons"
+	}
+	if downsql == "" {
+		downsql = "-- SQL statements reverting the update, separated by semicolons"
+	}
+	for _, file := range []struct{ suffix, content string }{{"up", upsql}, {"down", downsql}} {
+		fpath := path.Join(migrationFilePath, fmt.Sprintf("%s_%s.%s.sql", today, mname, file.suffix))
+		f, err := os.OpenFile(fpath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+		if err != nil {
+			beeLogger.Log.Fatalf("Could not create migration file: %s", err)
+		}
+		header := fmt.Sprintf("-- Migration %s_%s\n", utils.CamelCase(mname), today)
+		if _, err := f.WriteString(header + file.content + "\n"); err != nil {
+			beeLogger.Log.Fatalf("Could not write to file: %s", err)
+		}
+		utils.CloseFile(f)
+		fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+	}
+}
+
 const (
 	MigrationHeader = `package main
 						import (
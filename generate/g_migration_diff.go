@@ -0,0 +1,777 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package generate
+
+import (
+	"database/sql"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ClearGrass/qpbee/config"
+	"github.com/ClearGrass/qpbee/dialect"
+	beeLogger "github.com/ClearGrass/qpbee/logger"
+	"github.com/ClearGrass/qpbee/utils"
+)
+
+// todoPrefix starts the notes of the changes a diff migration cannot make,
+// left in the migration in place of their statements
+const todoPrefix = "-- TODO: "
+
+// sizeRegExp matches the size of a column type, e.g. varchar(255)
+var sizeRegExp = regexp.MustCompile(`\((\d+)\)`)
+
+// modelTable is the table of a model registered to the orm
+type modelTable struct {
+	name    string
+	model   string // Name of the struct.
+	columns []*modelColumn
+}
+
+// modelColumn is the column of a field of a model
+type modelColumn struct {
+	def      dialect.ColumnDef
+	family   string // Kind of type: string, text, int, float, bool or time.
+	size     string // Size of a string.
+	pk, auto bool
+	unique   bool
+	index    bool
+	refModel string      // Struct a rel(fk) or rel(one) field points to.
+	ref      *modelTable // Its table, nil if it is not registered.
+}
+
+// modelTag is a parsed orm tag, e.g. `orm:"size(64);null"`
+type modelTag map[string]string
+
+func parseModelTag(tag string) modelTag {
+	t := make(modelTag)
+	for _, v := range strings.Split(tag, ";") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if i := strings.Index(v, "("); i > 0 && strings.HasSuffix(v, ")") {
+			t[v[:i]] = v[i+1 : len(v)-1]
+			continue
+		}
+		t[v] = ""
+	}
+	return t
+}
+
+func (t modelTag) has(key string) bool {
+	_, ok := t[key]
+	return ok
+}
+
+// diffChange is a change of the schema, with the statements making it and reverting it
+type diffChange struct {
+	up, down []string
+}
+
+// GenerateDiffMigration generates a migration updating the schema of the database
+// to the models registered to the orm under the models directory: the tables,
+// columns, indexes and foreign keys missing are created, the ones no model has
+// dropped, and the columns of another type or nullability altered. The tables
+// without a model are left alone.
+func GenerateDiffMigration(mname, driver, connStr, curpath string) {
+	d, err := dialect.Get(driver)
+	if err != nil {
+		beeLogger.Log.Fatalf("%s", err)
+	}
+	modelsDir := path.Join(curpath, config.Conf.DirStruct.Models)
+	beeLogger.Log.Infof("Parsing models of '%s'", modelsDir)
+	tables := parseModels(d, modelsDir)
+	if len(tables) == 0 {
+		beeLogger.Log.Fatalf("Could not find any model registered with orm.RegisterModel in '%s'", modelsDir)
+	}
+
+	db, err := sql.Open(d.Name(), connStr)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not connect to '%s' database using '%s': %s", d.Name(), connStr, err)
+	}
+	defer db.Close()
+	beeLogger.Log.Info("Analyzing database tables...")
+	existing := make(map[string]bool)
+	for _, t := range getTableNames(db, d) {
+		existing[t] = true
+	}
+
+	var changes []diffChange
+	for _, t := range tables {
+		if existing[t.name] {
+			changes = append(changes, diffTable(db, d, t)...)
+		} else {
+			changes = append(changes, createTable(d, t))
+		}
+	}
+	if len(changes) == 0 {
+		beeLogger.Log.Info("The database matches the models, nothing to migrate")
+		os.Exit(0)
+	}
+
+	var up, down []string
+	for i := range changes {
+		up = append(up, changes[i].up...)
+		down = append(down, changes[len(changes)-1-i].down...)
+	}
+	if SQLFiles {
+		GenerateSQLMigration(mname, sqlStatements(up), sqlStatements(down), curpath)
+		return
+	}
+	GenerateMigration(mname, goStatements(up), goStatements(down), curpath)
+}
+
+// sqlStatements returns the statements of an SQL migration file
+func sqlStatements(statements []string) string {
+	var lines []string
+	for _, s := range statements {
+		if strings.HasPrefix(s, todoPrefix) {
+			lines = append(lines, s)
+		} else {
+			lines = append(lines, s+";")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// goStatements returns the statements of the Up or Down method of a Go migration
+func goStatements(statements []string) string {
+	var lines []string
+	for _, s := range statements {
+		if strings.HasPrefix(s, todoPrefix) {
+			lines = append(lines, "// TODO: "+strings.TrimPrefix(s, todoPrefix))
+		} else {
+			lines = append(lines, "m.SQL("+strconv.Quote(s)+")")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseModels returns the tables of the models registered to the orm in the
+// models directory, the ones referenced by a foreign key first
+func parseModels(d dialect.Dialect, dir string) []*modelTable {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not parse models: %s", err)
+	}
+
+	structs := make(map[string]*ast.StructType)
+	tableNames := make(map[string]string)
+	type registration struct{ model, prefix string }
+	var registered []registration
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.TypeSpec:
+					if s, ok := n.Type.(*ast.StructType); ok {
+						structs[n.Name.Name] = s
+					}
+				case *ast.FuncDecl:
+					if model, name, ok := tableNameMethod(n); ok {
+						tableNames[model] = name
+					}
+				case *ast.CallExpr:
+					sel, ok := n.Fun.(*ast.SelectorExpr)
+					if !ok || (sel.Sel.Name != "RegisterModel" && sel.Sel.Name != "RegisterModelWithPrefix") {
+						return true
+					}
+					args, prefix := n.Args, ""
+					if sel.Sel.Name == "RegisterModelWithPrefix" && len(args) > 0 {
+						if lit, ok := args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+							prefix, _ = strconv.Unquote(lit.Value)
+						}
+						args = args[1:]
+					}
+					for _, arg := range args {
+						if model := registeredModel(arg); model != "" {
+							registered = append(registered, registration{model, prefix})
+						} else {
+							beeLogger.Log.Warnf("Skipping model '%s' at %s, it is not new(Model) or &Model{}", exprString(arg), fset.Position(arg.Pos()))
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	byModel := make(map[string]*modelTable)
+	var tables []*modelTable
+	for _, r := range registered {
+		s, ok := structs[r.model]
+		if !ok {
+			beeLogger.Log.Warnf("Skipping model '%s', its struct is not in the models directory", r.model)
+			continue
+		}
+		name, ok := tableNames[r.model]
+		if !ok {
+			name = utils.SnakeString(r.model)
+		}
+		t := &modelTable{name: r.prefix + name, model: r.model}
+		t.columns = parseFields(d, t, s, structs)
+		byModel[r.model] = t
+		tables = append(tables, t)
+	}
+	for _, t := range tables {
+		for _, c := range t.columns {
+			if c.refModel == "" {
+				continue
+			}
+			switch ref := byModel[c.refModel]; {
+			case ref == nil:
+				beeLogger.Log.Warnf("Skipping the foreign key of '%s.%s', model '%s' is not registered", t.name, c.def.Name, c.refModel)
+			case primaryKey(ref) == nil:
+				beeLogger.Log.Warnf("Skipping the foreign key of '%s.%s', model '%s' has no primary key", t.name, c.def.Name, c.refModel)
+			default:
+				c.ref = ref
+			}
+		}
+	}
+
+	// The referenced tables first, so that they exist when the foreign keys are created
+	var (
+		sorted  []*modelTable
+		visited = make(map[*modelTable]bool)
+		visit   func(t *modelTable)
+	)
+	visit = func(t *modelTable) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		for _, c := range t.columns {
+			if c.ref != nil {
+				visit(c.ref)
+			}
+		}
+		sorted = append(sorted, t)
+	}
+	for _, t := range tables {
+		visit(t)
+	}
+	return sorted
+}
+
+// tableNameMethod returns the table name a TableName method of a model returns, if it is a literal
+func tableNameMethod(f *ast.FuncDecl) (model, name string, ok bool) {
+	if f.Name.Name != "TableName" || f.Recv == nil || len(f.Recv.List) != 1 || f.Body == nil || len(f.Body.List) != 1 {
+		return "", "", false
+	}
+	recv := f.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	ident, ok := recv.(*ast.Ident)
+	if !ok {
+		return "", "", false
+	}
+	ret, ok := f.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return "", "", false
+	}
+	lit, ok := ret.Results[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", "", false
+	}
+	name, err := strconv.Unquote(lit.Value)
+	return ident.Name, name, err == nil
+}
+
+// registeredModel returns the struct of an argument of orm.RegisterModel, new(Model) or &Model{}
+func registeredModel(arg ast.Expr) string {
+	switch arg := arg.(type) {
+	case *ast.CallExpr:
+		if fun, ok := arg.Fun.(*ast.Ident); ok && fun.Name == "new" && len(arg.Args) == 1 {
+			if ident, ok := arg.Args[0].(*ast.Ident); ok {
+				return ident.Name
+			}
+		}
+	case *ast.UnaryExpr:
+		if lit, ok := arg.X.(*ast.CompositeLit); ok && arg.Op == token.AND {
+			if ident, ok := lit.Type.(*ast.Ident); ok {
+				return ident.Name
+			}
+		}
+	}
+	return ""
+}
+
+// exprString returns the source of a simple expression, for the messages
+func exprString(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	case *ast.StarExpr:
+		return "*" + exprString(e.X)
+	case *ast.ArrayType:
+		return "[]" + exprString(e.Elt)
+	case *ast.UnaryExpr:
+		return e.Op.String() + exprString(e.X)
+	case *ast.CompositeLit:
+		return exprString(e.Type) + "{}"
+	case *ast.CallExpr:
+		return exprString(e.Fun) + "(...)"
+	}
+	return "?"
+}
+
+// parseFields returns the columns of the fields of a model, the ones of its embedded structs included
+func parseFields(d dialect.Dialect, t *modelTable, s *ast.StructType, structs map[string]*ast.StructType) []*modelColumn {
+	var columns []*modelColumn
+	for _, field := range s.Fields.List {
+		var tag modelTag
+		if field.Tag != nil {
+			raw, _ := strconv.Unquote(field.Tag.Value)
+			tag = parseModelTag(reflect.StructTag(raw).Get("orm"))
+		}
+		if tag.has("-") {
+			continue
+		}
+		if len(field.Names) == 0 {
+			ident, ok := field.Type.(*ast.Ident)
+			if ok && structs[ident.Name] != nil {
+				columns = append(columns, parseFields(d, t, structs[ident.Name], structs)...)
+			} else {
+				beeLogger.Log.Warnf("Skipping embedded '%s' of model '%s', its struct is not in the models directory", exprString(field.Type), t.model)
+			}
+			continue
+		}
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+			if c := parseField(d, t, name.Name, field.Type, tag); c != nil {
+				columns = append(columns, c)
+			}
+		}
+	}
+
+	// An int field named Id is the auto-incremented primary key of the models lacking one
+	if primaryKey(&modelTable{columns: columns}) == nil {
+		for _, c := range columns {
+			if c.def.Name == "id" && c.family == "int" {
+				c.pk, c.auto = true, true
+			}
+		}
+	}
+	return columns
+}
+
+// parseField returns the column of a field of a model, nil if it has none
+func parseField(d dialect.Dialect, t *modelTable, name string, typ ast.Expr, tag modelTag) *modelColumn {
+	c := &modelColumn{
+		pk:     tag.has("pk"),
+		auto:   tag.has("auto"),
+		unique: tag.has("unique"),
+		index:  tag.has("index"),
+	}
+	c.def.Name = utils.SnakeString(name)
+	c.def.Null = tag.has("null")
+
+	var fieldType string
+	switch rel := tag["rel"]; {
+	case tag.has("reverse"):
+		return nil
+	case rel == "m2m":
+		beeLogger.Log.Warnf("Skipping '%s.%s', the tables of the many to many relations are not supported", t.model, name)
+		return nil
+	case rel == "fk" || rel == "one":
+		c.refModel = relatedModel(typ)
+		if c.refModel == "" {
+			beeLogger.Log.Warnf("Skipping '%s.%s', the field of a relation must be a pointer to a model", t.model, name)
+			return nil
+		}
+		c.def.Name += "_id"
+		c.unique = c.unique || rel == "one"
+		fieldType = "int"
+	default:
+		fieldType = modelFieldType(typ, tag)
+		if fieldType == "" {
+			beeLogger.Log.Warnf("Skipping '%s.%s', its type %s is not supported", t.model, name, exprString(typ))
+			return nil
+		}
+	}
+	if column, ok := tag["column"]; ok && column != "" {
+		c.def.Name = column
+	}
+
+	typeDef, _, err := d.ColumnType(fieldType)
+	if err != nil {
+		beeLogger.Log.Warnf("Skipping '%s.%s': %s", t.model, name, err)
+		return nil
+	}
+	typeDef = strings.Replace(typeDef, " NOT NULL", "", 1)
+	typeDef = strings.Replace(typeDef, " DEFAULT NULL", "", 1)
+	c.def.Type = strings.TrimSpace(typeDef)
+	c.family, c.size = parseFieldTypeFamily(fieldType)
+
+	if def, ok := tag["default"]; ok {
+		switch c.family {
+		case "int", "float":
+			c.def.Default = def
+		case "bool":
+			c.def.Default = strconv.FormatBool(def == "true" || def == "1")
+		default:
+			c.def.Default = "'" + strings.Replace(def, "'", "''", -1) + "'"
+		}
+	}
+	return c
+}
+
+// relatedModel returns the struct the field of a relation points to, empty if it is not a pointer to a struct
+func relatedModel(typ ast.Expr) string {
+	if star, ok := typ.(*ast.StarExpr); ok {
+		if ident, ok := star.X.(*ast.Ident); ok {
+			return ident.Name
+		}
+	}
+	return ""
+}
+
+// modelFieldType returns the field type of "bee generate" of the Go type of a field
+func modelFieldType(typ ast.Expr, tag modelTag) string {
+	switch typ := typ.(type) {
+	case *ast.Ident:
+		switch typ.Name {
+		case "string":
+			if tag["type"] == "text" {
+				return "text"
+			}
+			if size, ok := tag["size"]; ok {
+				return "string:" + size
+			}
+			return "string:255"
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+			return "int"
+		case "bool":
+			return "bool"
+		case "float32", "float64":
+			return "float"
+		}
+	case *ast.SelectorExpr:
+		if exprString(typ) == "time.Time" {
+			return "datetime"
+		}
+	}
+	return ""
+}
+
+// parseFieldTypeFamily returns the kind of a field type of "bee generate", and its size
+func parseFieldTypeFamily(fieldType string) (family, size string) {
+	kv := strings.SplitN(fieldType, ":", 2)
+	switch kv[0] {
+	case "string":
+		if len(kv) == 2 {
+			size = kv[1]
+		}
+		return "string", size
+	case "datetime":
+		return "time", ""
+	}
+	return kv[0], ""
+}
+
+// columnFamily returns the kind of type of a column of the database, the way parseFieldTypeFamily does
+func columnFamily(c dialect.Column) (family, size string) {
+	t := strings.ToLower(c.DataType)
+	switch {
+	case strings.Contains(t, "char"):
+		if m := sizeRegExp.FindStringSubmatch(c.ColumnType); m != nil {
+			size = m[1]
+		}
+		return "string", size
+	case strings.Contains(t, "text") || t == "clob":
+		return "text", ""
+	case strings.HasPrefix(t, "bool") || strings.HasPrefix(strings.ToLower(c.ColumnType), "tinyint(1)"):
+		return "bool", ""
+	case strings.Contains(t, "int") || strings.Contains(t, "serial"):
+		return "int", ""
+	case t == "float" || t == "double" || t == "real" || t == "numeric" || t == "decimal" || t == "double precision":
+		return "float", ""
+	case strings.Contains(t, "date") || strings.Contains(t, "time"):
+		return "time", ""
+	}
+	return t, ""
+}
+
+// primaryKey returns the primary key column of a table, nil if none
+func primaryKey(t *modelTable) *modelColumn {
+	for _, c := range t.columns {
+		if c.pk || c.auto {
+			return c
+		}
+	}
+	return nil
+}
+
+// columnDefinition returns the definition of a column of a model in a CREATE or ALTER TABLE statement
+func columnDefinition(d dialect.Dialect, c *modelColumn) string {
+	switch {
+	case c.auto:
+		return d.Quote(c.def.Name) + strings.TrimPrefix(d.IDColumn(), d.Quote("id"))
+	case c.pk:
+		return d.Quote(c.def.Name) + " " + c.def.Type + " NOT NULL PRIMARY KEY"
+	}
+	return dialect.ColumnSQL(d, c.def)
+}
+
+// indexName returns the name of the index of a column of a model
+func indexName(table string, c *modelColumn) string {
+	if c.unique {
+		return table + "_" + c.def.Name + "_uniq"
+	}
+	return table + "_" + c.def.Name + "_idx"
+}
+
+// foreignKeyName returns the name of the foreign key of a column of a model
+func foreignKeyName(table string, c *modelColumn) string {
+	return "fk_" + table + "_" + c.def.Name
+}
+
+// createIndex returns the statement creating an index
+func createIndex(d dialect.Dialect, table, name string, unique bool, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = d.Quote(c)
+	}
+	create := "CREATE INDEX "
+	if unique {
+		create = "CREATE UNIQUE INDEX "
+	}
+	return create + d.Quote(name) + " ON " + d.Quote(table) + " (" + strings.Join(quoted, ", ") + ")"
+}
+
+// foreignKeyDefinition returns the definition of the foreign key of a column of a model in a CREATE TABLE statement
+func foreignKeyDefinition(d dialect.Dialect, table string, c *modelColumn) string {
+	return "CONSTRAINT " + d.Quote(foreignKeyName(table, c)) + " FOREIGN KEY (" + d.Quote(c.def.Name) + ") REFERENCES " +
+		d.Quote(c.ref.name) + " (" + d.Quote(primaryKey(c.ref).def.Name) + ")"
+}
+
+// createTable returns the change creating the table of a model, with its indexes and foreign keys
+func createTable(d dialect.Dialect, t *modelTable) diffChange {
+	var defs, fks, indexes []string
+	for _, c := range t.columns {
+		defs = append(defs, columnDefinition(d, c))
+		if (c.unique || c.index) && !c.pk && !c.auto {
+			indexes = append(indexes, createIndex(d, t.name, indexName(t.name, c), c.unique, []string{c.def.Name}))
+		}
+		if c.ref != nil {
+			fks = append(fks, foreignKeyDefinition(d, t.name, c))
+		}
+	}
+	up := []string{"CREATE TABLE " + d.Quote(t.name) + " (\n\t" + strings.Join(append(defs, fks...), ",\n\t") + "\n)"}
+	return diffChange{up: append(up, indexes...), down: []string{"DROP TABLE " + d.Quote(t.name)}}
+}
+
+// diffTable returns the changes updating an existing table to its model: the foreign
+// keys, indexes and columns the model lacks dropped first, then the columns, indexes
+// and foreign keys it adds
+func diffTable(db *sql.DB, d dialect.Dialect, t *modelTable) []diffChange {
+	columns, err := d.Columns(db, t.name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not show columns of '%s': %s", t.name, err)
+	}
+	constraints, err := d.Constraints(db, t.name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query constraints of '%s': %s", t.name, err)
+	}
+	indexes, err := d.Indexes(db, t.name)
+	if err != nil {
+		beeLogger.Log.Fatalf("Could not query indexes of '%s': %s", t.name, err)
+	}
+
+	wanted := make(map[string]*modelColumn)
+	for _, c := range t.columns {
+		wanted[c.def.Name] = c
+	}
+	live := make(map[string]dialect.Column)
+	for _, c := range columns {
+		live[c.Name] = c
+	}
+	// MySQL indexes the foreign keys by itself
+	fkColumns := make(map[string]bool)
+	liveFKs := make(map[string]bool)
+	for _, c := range constraints {
+		if c.Type == dialect.ForeignKey {
+			fkColumns[c.Column] = true
+			liveFKs[c.Column] = true
+		}
+	}
+	for _, c := range t.columns {
+		if c.ref != nil {
+			fkColumns[c.def.Name] = true
+		}
+	}
+
+	var changes []diffChange
+	table := d.Quote(t.name)
+	change := func(up []string, upErr error, down []string, downErr error) {
+		if upErr != nil {
+			beeLogger.Log.Warnf("%s, left as a TODO in the migration", upErr)
+		}
+		changes = append(changes, diffChange{up: statementsOrTodo(up, upErr), down: statementsOrTodo(down, downErr)})
+	}
+
+	dropped := make(map[string]bool)
+	for _, fk := range constraints {
+		if fk.Type != dialect.ForeignKey || dropped[fk.Name] {
+			continue
+		}
+		if c := wanted[fk.Column]; c != nil && c.ref != nil {
+			continue
+		}
+		dropped[fk.Name] = true
+		drop, err := d.DropForeignKey(t.name, fk.Name)
+		add, addErr := d.AddForeignKey(t.name, fk.Name, fk.Column, fk.RefTable, fk.RefColumn)
+		change([]string{drop}, err, []string{add}, addErr)
+	}
+
+	for _, idx := range indexes {
+		if indexWanted(idx, wanted) || (len(idx.Columns) == 1 && fkColumns[idx.Columns[0]]) {
+			continue
+		}
+		if idx.Constraint {
+			if idx.Unique {
+				changes = append(changes, diffChange{
+					up:   []string{todoPrefix + "drop the unique constraint of index '" + idx.Name + "' of '" + t.name + "'"},
+					down: []string{todoPrefix + "re-create the unique constraint of index '" + idx.Name + "' of '" + t.name + "' on " + strings.Join(idx.Columns, ", ")},
+				})
+			}
+			continue
+		}
+		changes = append(changes, diffChange{
+			up:   []string{d.DropIndex(t.name, idx.Name)},
+			down: []string{createIndex(d, t.name, idx.Name, idx.Unique, idx.Columns)},
+		})
+	}
+
+	for _, c := range columns {
+		if wanted[c.Name] != nil {
+			continue
+		}
+		changes = append(changes, diffChange{
+			up:   []string{"ALTER TABLE " + table + " DROP COLUMN " + d.Quote(c.Name)},
+			down: []string{"ALTER TABLE " + table + " ADD COLUMN " + dialect.ColumnSQL(d, liveColumnDef(c))},
+		})
+	}
+
+	for _, c := range t.columns {
+		if _, ok := live[c.def.Name]; ok {
+			continue
+		}
+		changes = append(changes, diffChange{
+			up:   []string{"ALTER TABLE " + table + " ADD COLUMN " + columnDefinition(d, c)},
+			down: []string{"ALTER TABLE " + table + " DROP COLUMN " + d.Quote(c.def.Name)},
+		})
+	}
+
+	for _, c := range t.columns {
+		l, ok := live[c.def.Name]
+		if !ok || c.pk || c.auto || l.PrimaryKey {
+			continue
+		}
+		family, size := columnFamily(l)
+		if l.Nullable == c.def.Null && family == c.family && (family != "string" || size == "" || c.size == "" || size == c.size) {
+			continue
+		}
+		up, err := d.ModifyColumn(t.name, c.def)
+		down, downErr := d.ModifyColumn(t.name, liveColumnDef(l))
+		change(up, err, down, downErr)
+	}
+
+	for _, c := range t.columns {
+		if !(c.unique || c.index) || c.pk || c.auto || hasIndex(indexes, c) {
+			continue
+		}
+		name := indexName(t.name, c)
+		changes = append(changes, diffChange{
+			up:   []string{createIndex(d, t.name, name, c.unique, []string{c.def.Name})},
+			down: []string{d.DropIndex(t.name, name)},
+		})
+	}
+
+	for _, c := range t.columns {
+		if c.ref == nil || liveFKs[c.def.Name] {
+			continue
+		}
+		name := foreignKeyName(t.name, c)
+		add, err := d.AddForeignKey(t.name, name, c.def.Name, c.ref.name, primaryKey(c.ref).def.Name)
+		drop, dropErr := d.DropForeignKey(t.name, name)
+		change([]string{add}, err, []string{drop}, dropErr)
+	}
+	return changes
+}
+
+// statementsOrTodo returns the statements of a change, or the note of why it cannot be made
+func statementsOrTodo(statements []string, err error) []string {
+	if err != nil {
+		return []string{todoPrefix + err.Error()}
+	}
+	return statements
+}
+
+// indexWanted reports whether an index is the one of a column of the model
+func indexWanted(idx dialect.Index, wanted map[string]*modelColumn) bool {
+	if len(idx.Columns) != 1 {
+		return false
+	}
+	c := wanted[idx.Columns[0]]
+	return c != nil && (c.unique || c.index) && c.unique == idx.Unique
+}
+
+// hasIndex reports whether a column of the model is indexed the way it wants
+func hasIndex(indexes []dialect.Index, c *modelColumn) bool {
+	for _, idx := range indexes {
+		if len(idx.Columns) == 1 && idx.Columns[0] == c.def.Name && idx.Unique == c.unique {
+			return true
+		}
+	}
+	return false
+}
+
+// liveColumnDef returns the definition of a column of the database
+func liveColumnDef(c dialect.Column) dialect.ColumnDef {
+	return dialect.ColumnDef{Name: c.Name, Type: c.ColumnType, Null: c.Nullable, Default: sqlDefault(c.Default)}
+}
+
+// sqlDefault returns the SQL expression of the default value of a column of the
+// database, which MySQL and SQLite give unquoted
+func sqlDefault(def string) string {
+	switch {
+	case def == "" || strings.ToUpper(def) == "NULL":
+		return ""
+	case dialect.IsCurrentTimestamp(def), strings.HasPrefix(def, "'"), strings.Contains(def, "("), strings.Contains(def, "::"):
+		return def
+	case strings.ToLower(def) == "true" || strings.ToLower(def) == "false":
+		return def
+	}
+	if _, err := strconv.ParseFloat(def, 64); err == nil {
+		return def
+	}
+	return "'" + strings.Replace(def, "'", "''", -1) + "'"
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package swaggergen
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/astaxie/beego/swagger"
+	"github.com/astaxie/beego/utils"
+)
+
+var (
+	astCache   = make(map[string]*cachedDir) // Parsed directories by path.
+	astPkgDirs map[*ast.Package]string       // Directories of the parsed packages of the application.
+	docsInputs map[string]bool               // Directories of the routers, controllers and models of the docs.
+)
+
+// cachedDir holds the packages parsed from a directory,
+// along with the state of its Go files when they were parsed
+type cachedDir struct {
+	files map[string]cachedFile
+	pkgs  map[string]*ast.Package
+}
+
+type cachedFile struct {
+	modTime int64
+	size    int64
+	hash    string // MD5 hash of the content.
+}
+
+// docsError aborts the generation of the docs, see fatalf
+type docsError struct {
+	err error
+}
+
+// fatalf aborts the generation of the docs. "bee generate docs" exits
+// with the error, while "bee run" reports it and keeps running.
+func fatalf(format string, args ...interface{}) {
+	panic(docsError{fmt.Errorf(format, args...)})
+}
+
+// recoverDocs turns an aborted generation, or any panic while analysing
+// unexpected code, into an error
+func recoverDocs(err *error) {
+	if e := recover(); e != nil {
+		if de, ok := e.(docsError); ok {
+			*err = de.err
+		} else {
+			*err = fmt.Errorf("Failed to generate the docs: %v", e)
+		}
+	}
+}
+
+// resetDocs clears what the previous generation of the docs collected
+func resetDocs() {
+	pkgCache = make(map[string]struct{})
+	controllerComments = make(map[string]string)
+	importlist = make(map[string]string)
+	controllerList = make(map[string]map[string]*swagger.Item)
+	modelsList = make(map[string]map[string]swagger.Schema)
+	rootapi = swagger.Swagger{}
+	docsInputs = make(map[string]bool)
+}
+
+// useModelPackage records that the docs refer to models of the package
+func useModelPackage(pkg *ast.Package) {
+	if dir, ok := astPkgDirs[pkg]; ok {
+		docsInputs[dir] = true
+	}
+}
+
+// UpdateDocs generates the docs of the application again if its routers,
+// controllers or the models they refer to changed since the last call.
+// Directories are only parsed again when their Go files changed, based on
+// their modification time and size first, and on their content if touched.
+// It returns whether swagger.json or swagger.yml was written.
+func UpdateDocs(curpath string) (written bool, err error) {
+	defer func() {
+		if err != nil {
+			// Start over next time
+			docsInputs = make(map[string]bool)
+		}
+	}()
+	defer recoverDocs(&err)
+
+	if p, err := filepath.EvalSymlinks(curpath); err == nil {
+		curpath = p
+	}
+	changed := parsePackagesFromDir(curpath)
+
+	stale := len(docsInputs) == 0 || !utils.FileExists(filepath.Join(curpath, "swagger", "swagger.json"))
+	for dir := range docsInputs {
+		if stale {
+			break
+		}
+		// Directories outside of the application, e.g. vendored controllers,
+		// are checked as well
+		if _, dirChanged, err := parseDirCached(dir); changed[dir] || dirChanged || err != nil {
+			stale = true
+		}
+	}
+	if !stale {
+		return false, nil
+	}
+
+	resetDocs()
+	generateDocs(curpath)
+	return writeDocs(curpath)
+}
+
+// parseDirCached parses the Go files of the directory, or returns the packages
+// parsed before if the files did not change. It also reports whether they did.
+func parseDirCached(dir string) (map[string]*ast.Package, bool, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		delete(astCache, dir)
+		return nil, true, err
+	}
+	files := make(map[string]cachedFile)
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		files[name] = cachedFile{modTime: info.ModTime().UnixNano(), size: info.Size()}
+	}
+
+	if cached, ok := astCache[dir]; ok && cached.unchanged(dir, files) {
+		cached.files = files
+		return cached.pkgs, false, nil
+	}
+
+	fileSet := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fileSet, dir, func(info os.FileInfo) bool {
+		_, ok := files[info.Name()]
+		return ok
+	}, parser.ParseComments)
+	if err != nil {
+		delete(astCache, dir)
+		return nil, true, err
+	}
+	for name, f := range files {
+		f.hash = fileHash(filepath.Join(dir, name))
+		files[name] = f
+	}
+	astCache[dir] = &cachedDir{files: files, pkgs: pkgs}
+	return pkgs, true, nil
+}
+
+// unchanged reports whether the files are the same as when the directory was
+// parsed. Touched files are hashed, and unchanged if their content is the same.
+func (d *cachedDir) unchanged(dir string, files map[string]cachedFile) bool {
+	if len(files) != len(d.files) {
+		return false
+	}
+	for name, f := range files {
+		old, ok := d.files[name]
+		if !ok || f.size != old.size {
+			return false
+		}
+		if f.modTime != old.modTime {
+			if fileHash(filepath.Join(dir, name)) != old.hash {
+				return false
+			}
+		}
+		f.hash = old.hash
+		files[name] = f
+	}
+	return true
+}
+
+func fileHash(filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeDocs writes swagger.json and swagger.yml, unless their content is
+// the same. It returns whether one of them was written.
+func writeDocs(curpath string) (bool, error) {
+	dt, err := json.MarshalIndent(rootapi, "", "    ")
+	if err != nil {
+		return false, err
+	}
+	dtyml, err := yaml.Marshal(rootapi)
+	if err != nil {
+		return false, err
+	}
+
+	os.Mkdir(filepath.Join(curpath, "swagger"), 0755)
+	written := false
+	for name, data := range map[string][]byte{"swagger.json": dt, "swagger.yml": dtyml} {
+		filename := filepath.Join(curpath, "swagger", name)
+		if old, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(old, data) {
+			continue
+		}
+		if err := ioutil.WriteFile(filename, data, 0666); err != nil {
+			return written, err
+		}
+		written = true
+	}
+	return written, nil
+}
@@ -15,7 +15,6 @@
 package swaggergen
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"go/ast"
@@ -31,8 +30,6 @@ import (
 	"strings"
 	"unicode"
 
-	"gopkg.in/yaml.v2"
-
 	"github.com/astaxie/beego/swagger"
 	"github.com/astaxie/beego/utils"
 	beeLogger "github.com/ClearGrass/qpbee/logger"
@@ -85,15 +82,24 @@ var stdlibObject = map[string]string{
 }
 
 func init() {
-	pkgCache = make(map[string]struct{})
-	controllerComments = make(map[string]string)
-	importlist = make(map[string]string)
-	controllerList = make(map[string]map[string]*swagger.Item)
-	modelsList = make(map[string]map[string]swagger.Schema)
+	resetDocs()
 	astPkgs = make([]*ast.Package, 0)
 }
 
+// ParsePackagesFromDir parses the packages of the application,
+// whose models are looked up while generating the docs
 func ParsePackagesFromDir(dirpath string) {
+	parsePackagesFromDir(dirpath)
+}
+
+// parsePackagesFromDir parses the packages of the application, reusing the
+// cached ASTs of the unchanged directories. It returns the directories
+// which changed since they were last parsed, including the removed ones.
+func parsePackagesFromDir(dirpath string) map[string]bool {
+	astPkgs = astPkgs[:0]
+	astPkgDirs = make(map[*ast.Package]string)
+	changed := make(map[string]bool)
+	seen := make(map[string]bool)
 	c := make(chan error)
 
 	go func() {
@@ -110,7 +116,12 @@ func ParsePackagesFromDir(dirpath string) {
 			if !(len(fpath) == len(dirpath)+7 && strings.HasSuffix(fpath, "vendor")) &&
 				!strings.Contains(fpath, "tests") &&
 				!(len(fpath) > len(dirpath) && fpath[len(dirpath)+1] == '.') {
-				err = parsePackageFromDir(fpath)
+				seen[fpath] = true
+				var dirChanged bool
+				dirChanged, err = parsePackageFromDir(fpath)
+				if dirChanged {
+					changed[fpath] = true
+				}
 				if err != nil {
 					// Send the error to through the channel and continue walking
 					c <- fmt.Errorf("Error while parsing directory: %s", err.Error())
@@ -125,31 +136,55 @@ func ParsePackagesFromDir(dirpath string) {
 	for err := range c {
 		beeLogger.Log.Warnf("%s", err)
 	}
+
+	// Forget the directories removed since the last time
+	for dir := range astCache {
+		if !seen[dir] && strings.HasPrefix(dir, dirpath+string(filepath.Separator)) {
+			delete(astCache, dir)
+			changed[dir] = true
+		}
+	}
+	return changed
 }
 
-func parsePackageFromDir(path string) error {
-	fileSet := token.NewFileSet()
-	folderPkgs, err := parser.ParseDir(fileSet, path, func(info os.FileInfo) bool {
-		name := info.Name()
-		return !info.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".go")
-	}, parser.ParseComments)
+// parsePackageFromDir parses the packages of the directory, or reuses their
+// cached ASTs. It returns whether the directory changed since it was last parsed.
+func parsePackageFromDir(path string) (bool, error) {
+	folderPkgs, changed, err := parseDirCached(path)
 	if err != nil {
-		return err
+		return changed, err
 	}
 
 	for _, v := range folderPkgs {
 		astPkgs = append(astPkgs, v)
+		astPkgDirs[v] = path
 	}
 
-	return nil
+	return changed, nil
 }
 
+// GenerateDocs generates the swagger.json and swagger.yml files of the application
 func GenerateDocs(curpath string) {
+	err := func() (err error) {
+		defer recoverDocs(&err)
+		generateDocs(curpath)
+		_, err = writeDocs(curpath)
+		return
+	}()
+	if err != nil {
+		beeLogger.Log.Fatalf("%s", err)
+	}
+}
+
+// generateDocs analyses the routers of the application, the controllers
+// they include and the models these refer to. It aborts with fatalf.
+func generateDocs(curpath string) {
 	fset := token.NewFileSet()
 
+	docsInputs[filepath.Join(curpath, "routers")] = true
 	f, err := parser.ParseFile(fset, filepath.Join(curpath, "routers", "router.go"), nil, parser.ParseComments)
 	if err != nil {
-		beeLogger.Log.Fatalf("Error while parsing router.go: %s", err)
+		fatalf("Error while parsing router.go: %s", err)
 	}
 
 	rootapi.Infos = swagger.Information{}
@@ -196,16 +231,16 @@ func GenerateDocs(curpath string) {
 					var out swagger.Security
 					p := getparams(strings.TrimSpace(s[len("@SecurityDefinition"):]))
 					if len(p) < 2 {
-						beeLogger.Log.Fatalf("Not enough params for security: %d\n", len(p))
+						fatalf("Not enough params for security: %d", len(p))
 					}
 					out.Type = p[1]
 					switch out.Type {
 					case "oauth2":
 						if len(p) < 6 {
-							beeLogger.Log.Fatalf("Not enough params for oauth2: %d\n", len(p))
+							fatalf("Not enough params for oauth2: %d", len(p))
 						}
 						if !(p[3] == "implicit" || p[3] == "password" || p[3] == "application" || p[3] == "accessCode") {
-							beeLogger.Log.Fatalf("Unknown flow type: %s. Possible values are `implicit`, `password`, `application` or `accessCode`.\n", p[1])
+							fatalf("Unknown flow type: %s. Possible values are `implicit`, `password`, `application` or `accessCode`.", p[1])
 						}
 						out.AuthorizationURL = p[2]
 						out.Flow = p[3]
@@ -218,10 +253,10 @@ func GenerateDocs(curpath string) {
 						}
 					case "apiKey":
 						if len(p) < 4 {
-							beeLogger.Log.Fatalf("Not enough params for apiKey: %d\n", len(p))
+							fatalf("Not enough params for apiKey: %d", len(p))
 						}
 						if !(p[3] == "header" || p[3] == "query") {
-							beeLogger.Log.Fatalf("Unknown in type: %s. Possible values are `query` or `header`.\n", p[4])
+							fatalf("Unknown in type: %s. Possible values are `query` or `header`.", p[4])
 						}
 						out.Name = p[2]
 						out.In = p[3]
@@ -233,7 +268,7 @@ func GenerateDocs(curpath string) {
 							out.Description = strings.Trim(p[2], `" `)
 						}
 					default:
-						beeLogger.Log.Fatalf("Unknown security type: %s. Possible values are `oauth2`, `apiKey` or `basic`.\n", p[1])
+						fatalf("Unknown security type: %s. Possible values are `oauth2`, `apiKey` or `basic`.", p[1])
 					}
 					rootapi.SecurityDefinitions[p[0]] = out
 				} else if strings.HasPrefix(s, "@Security") {
@@ -307,27 +342,6 @@ func GenerateDocs(curpath string) {
 			}
 		}
 	}
-	os.Mkdir(path.Join(curpath, "swagger"), 0755)
-	fd, err := os.Create(path.Join(curpath, "swagger", "swagger.json"))
-	if err != nil {
-		panic(err)
-	}
-	fdyml, err := os.Create(path.Join(curpath, "swagger", "swagger.yml"))
-	if err != nil {
-		panic(err)
-	}
-	defer fdyml.Close()
-	defer fd.Close()
-	dt, err := json.MarshalIndent(rootapi, "", "    ")
-	dtyml, erryml := yaml.Marshal(rootapi)
-	if err != nil || erryml != nil {
-		panic(err)
-	}
-	_, err = fd.Write(dt)
-	_, erryml = fdyml.Write(dtyml)
-	if err != nil || erryml != nil {
-		panic(err)
-	}
 }
 
 // analyseNewNamespace returns version and the others params
@@ -407,7 +421,7 @@ func analyseControllerPkg(vendorPath, localName, pkgpath string) {
 	}
 	gopaths := bu.GetGOPATHs()
 	if len(gopaths) == 0 {
-		beeLogger.Log.Fatal("GOPATH environment variable is not set or empty")
+		fatalf("GOPATH environment variable is not set or empty")
 	}
 	pkgRealpath := ""
 
@@ -430,16 +444,13 @@ func analyseControllerPkg(vendorPath, localName, pkgpath string) {
 		}
 		pkgCache[pkgpath] = struct{}{}
 	} else {
-		beeLogger.Log.Fatalf("Package '%s' does not exist in the GOPATH or vendor path", pkgpath)
+		fatalf("Package '%s' does not exist in the GOPATH or vendor path", pkgpath)
 	}
 
-	fileSet := token.NewFileSet()
-	astPkgs, err := parser.ParseDir(fileSet, pkgRealpath, func(info os.FileInfo) bool {
-		name := info.Name()
-		return !info.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".go")
-	}, parser.ParseComments)
+	docsInputs[pkgRealpath] = true
+	astPkgs, _, err := parseDirCached(pkgRealpath)
 	if err != nil {
-		beeLogger.Log.Fatalf("Error while parsing dir at '%s': %s", pkgpath, err)
+		fatalf("Error while parsing dir at '%s': %s", pkgpath, err)
 	}
 	for _, pkg := range astPkgs {
 		for _, fl := range pkg.Files {
@@ -477,7 +488,7 @@ func isSystemPackage(pkgpath string) bool {
 		goroot = runtime.GOROOT()
 	}
 	if goroot == "" {
-		beeLogger.Log.Fatalf("GOROOT environment variable is not set or empty")
+		fatalf("GOROOT environment variable is not set or empty")
 	}
 
 	wg, _ := filepath.EvalSymlinks(filepath.Join(goroot, "src", "pkg", pkgpath))
@@ -545,7 +556,7 @@ func parserComments(f *ast.FuncDecl, controllerName, pkgpath string) error {
 					ss = strings.TrimSpace(ss[pos:])
 					schemaName, pos := peekNextSplitString(ss)
 					if schemaName == "" {
-						beeLogger.Log.Fatalf("[%s.%s] Schema must follow {object} or {array}", controllerName, funcName)
+						fatalf("[%s.%s] Schema must follow {object} or {array}", controllerName, funcName)
 					}
 					if strings.HasPrefix(schemaName, "[]") {
 						schemaName = schemaName[2:]
@@ -582,7 +593,7 @@ func parserComments(f *ast.FuncDecl, controllerName, pkgpath string) error {
 				para := swagger.Parameter{}
 				p := getparams(strings.TrimSpace(t[len("@Param "):]))
 				if len(p) < 4 {
-					beeLogger.Log.Fatal(controllerName + "_" + funcName + "'s comments @Param should have at least 4 params")
+					fatalf("%s_%s's comments @Param should have at least 4 params", controllerName, funcName)
 				}
 				paramNames := strings.SplitN(p[0], "=>", 2)
 				para.Name = paramNames[0]
@@ -864,6 +875,7 @@ func getModel(str string) (objectname string, m swagger.Schema, realTypes []stri
 	m.Type = "object"
 	for _, pkg := range astPkgs {
 		if strs[0] == pkg.Name {
+			useModelPackage(pkg)
 			for _, fl := range pkg.Files {
 				for k, d := range fl.Scope.Objects {
 					if d.Kind == ast.Typ {
@@ -893,7 +905,7 @@ func getModel(str string) (objectname string, m swagger.Schema, realTypes []stri
 func parseObject(d *ast.Object, k string, m *swagger.Schema, realTypes *[]string, astPkgs []*ast.Package, packageName string) {
 	ts, ok := d.Decl.(*ast.TypeSpec)
 	if !ok {
-		beeLogger.Log.Fatalf("Unknown type without TypeSec: %v\n", d)
+		fatalf("Unknown type without TypeSec: %v", d)
 	}
 	// TODO support other types, such as `ArrayType`, `MapType`, `InterfaceType` etc...
 	st, ok := ts.Type.(*ast.StructType)
@@ -1009,6 +1021,7 @@ func parseObject(d *ast.Object, k string, m *swagger.Schema, realTypes *[]string
 					for _, fl := range pkg.Files {
 						for nameOfObj, obj := range fl.Scope.Objects {
 							if obj.Name == fmt.Sprint(field.Type) {
+								useModelPackage(pkg)
 								parseObject(obj, nameOfObj, m, realTypes, astPkgs, pkg.Name)
 							}
 						}
@@ -1082,7 +1095,7 @@ func getSecurity(t string) (security map[string][]string) {
 	security = make(map[string][]string)
 	p := getparams(strings.TrimSpace(t[len("@Security"):]))
 	if len(p) == 0 {
-		beeLogger.Log.Fatalf("No params for security specified\n")
+		fatalf("No params for security specified")
 	}
 	security[p[0]] = make([]string, 0)
 	for i := 1; i < len(p); i++ {
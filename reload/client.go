@@ -0,0 +1,33 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package reload holds the live-reload browser client of "bee run", which
+// "bee new" also writes to the static files of the applications.
+package reload
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Client returns the live-reload browser client. It connects to the URL set in
+// window.beeReloadURL, injected by the live-reload proxy, or to the given port
+// of the live-reload server on the page's host.
+func Client(port int) string {
+	return strings.Replace(jsClient, "{{ReloadPort}}", strconv.Itoa(port), -1)
+}
+
+// jsClient is the minified live-reload browser client
+const jsClient = `(function(){if(window.beeReloadLoaded)return;window.beeReloadLoaded=!0;var d=null;function e(a){return String(a).replace(/[&<>"]/g,function(a){return{"&":"&amp;","<":"&lt;",">":"&gt;",'"':"&quot;"}[a]})}function f(){d&&(d.parentNode.removeChild(d),d=null)}function g(a){f();d=document.createElement("div");d.id="bee-build-error";d.setAttribute("style","position:fixed;top:0;left:0;right:0;bottom:0;z-index:2147483647;overflow:auto;padding:24px;background:rgba(0,0,0,.9);color:#e8e8e8;font:13px/1.6 Menlo,Consolas,monospace;text-align:left");var b='<div style="color:#ff5f5f;font-size:18px;margin-bottom:16px">Build failed</div>',c=a.errors||[];for(var h=0;h<c.length;h++)b+='<div><span style="color:#5fd7ff">'+e(c[h].file)+":"+c[h].line+(c[h].column?":"+c[h].column:"")+"</span> "+e(c[h].message)+"</div>";c.length||(b+='<pre style="margin:0;white-space:pre-wrap">'+e(a.output||"")+"</pre>");d.innerHTML=b;document.body.appendChild(d)}function k(a){var b=document.querySelectorAll('link[rel="stylesheet"]'),c=a?"/"+a.split("/").pop():"",h=!1;for(var l=0;l<b.length;l++){var m=b[l].href.split("?")[0];c&&m.slice(-c.length)!=c||(b[l].href=m+"?_bee="+(new Date).getTime(),h=!0)}h||location.reload()}function b(a){var c=new WebSocket(a);c.onclose=function(){setTimeout(function(){b(a)},2E3)};c.onmessage=function(a){var b;try{b=JSON.parse(a.data)}catch(c){b={type:"reload"}}switch(b.type){case "build-failed":g(b);break;case "build-ok":f();break;case "css-changed":k(b.path);break;case "reload":location.reload()}}}try{if(window.WebSocket)try{b(window.beeReloadURL||"ws://"+(location.hostname||"localhost")+":{{ReloadPort}}/reload")}catch(a){console.error(a)}else console.log("Your browser does not support WebSockets.")}catch(a){console.error("Exception during connecting to Reload:",a)}})();
+`
@@ -0,0 +1,148 @@
+// Copyright 2017 bee authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var goVersionRegExp = regexp.MustCompile(`^go(\d+)\.(\d+)`)
+
+// GoModulesEnabled reports whether the Go tool may run in module-aware mode,
+// i.e. modules have not been explicitly disabled with GO111MODULE=off.
+func GoModulesEnabled() bool {
+	return os.Getenv("GO111MODULE") != "off"
+}
+
+// SearchGoMod walks up from dir looking for the nearest go.mod file.
+// It returns a boolean, the module root directory and the module path
+// declared by the 'module' directive.
+func SearchGoMod(dir string) (bool, string, string) {
+	if !GoModulesEnabled() {
+		return false, "", ""
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, "", ""
+	}
+
+	for {
+		gomod := filepath.Join(dir, "go.mod")
+		if fi, err := os.Stat(gomod); err == nil && !fi.IsDir() {
+			modPath, err := parseModulePath(gomod)
+			if err != nil {
+				return false, "", ""
+			}
+			return true, dir, modPath
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false, "", ""
+		}
+		dir = parent
+	}
+}
+
+// GetModulePackagePath returns the import path of the package located in dir
+// by joining the nearest module path with dir's path relative to the module root.
+func GetModulePackagePath(dir string) (string, bool) {
+	found, modRoot, modPath := SearchGoMod(dir)
+	if !found {
+		return "", false
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(modRoot, absDir)
+	if err != nil {
+		return "", false
+	}
+	if rel == "." {
+		return modPath, true
+	}
+	return modPath + "/" + filepath.ToSlash(rel), true
+}
+
+// NeedsGoMod reports whether a freshly created application at apppath
+// should get its own go.mod file: modules are enabled, the application is not
+// created in GOPATH mode and no enclosing module already exists.
+func NeedsGoMod(apppath string) bool {
+	if !GoModulesEnabled() {
+		return false
+	}
+	if os.Getenv("GO111MODULE") != "on" && IsInGOPATH(apppath) {
+		return false
+	}
+	found, _, _ := SearchGoMod(filepath.Dir(apppath))
+	return !found
+}
+
+// GoModContent returns the content of a go.mod file for the given module path.
+func GoModContent(modPath string) string {
+	content := fmt.Sprintf("module %s\n", modPath)
+	if m := goVersionRegExp.FindStringSubmatch(runtime.Version()); m != nil {
+		content += fmt.Sprintf("\ngo %s.%s\n", m[1], m[2])
+	}
+	return content
+}
+
+// GoListDir resolves the directory of the given import path using "go list".
+// It is used to locate packages when running outside of GOPATH.
+func GoListDir(pkg string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", "list", "-f", "{{.Dir}}", pkg)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s", strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// parseModulePath extracts the module path from the 'module' directive of a go.mod file.
+func parseModulePath(gomod string) (string, error) {
+	data, err := ioutil.ReadFile(gomod)
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		return strings.Trim(fields[1], "\"`"), nil
+	}
+	return "", fmt.Errorf("no module directive found in '%s'", gomod)
+}
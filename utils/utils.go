@@ -147,9 +147,9 @@ func AskForConfirmation() bool {
 	}
 	okayResponses := []string{"y", "Y", "yes", "Yes", "YES"}
 	nokayResponses := []string{"n", "N", "no", "No", "NO"}
-	if containsString(okayResponses, response) {
+	if ContainsString(okayResponses, response) {
 		return true
-	} else if containsString(nokayResponses, response) {
+	} else if ContainsString(nokayResponses, response) {
 		return false
 	} else {
 		fmt.Println("Please type yes or no and then press enter:")
@@ -157,7 +157,8 @@ func AskForConfirmation() bool {
 	}
 }
 
-func containsString(slice []string, element string) bool {
+// ContainsString returns whether the slice contains the given element
+func ContainsString(slice []string, element string) bool {
 	for _, elem := range slice {
 		if elem == element {
 			return true
@@ -309,12 +310,26 @@ func CheckEnv(appname string) (apppath, packpath string, err error) {
 	}
 	currpath, _ := os.Getwd()
 	currpath = filepath.Join(currpath, appname)
-	for _, gpath := range gps {
-		gsrcpath := filepath.Join(gpath, "src")
-		if strings.HasPrefix(strings.ToLower(currpath), strings.ToLower(gsrcpath)) {
-			packpath = strings.Replace(currpath[len(gsrcpath)+1:], string(filepath.Separator), "/", -1)
-			return currpath, packpath, nil
+	if os.Getenv("GO111MODULE") != "on" {
+		for _, gpath := range gps {
+			gsrcpath := filepath.Join(gpath, "src")
+			if strings.HasPrefix(strings.ToLower(currpath), strings.ToLower(gsrcpath)) {
+				packpath = strings.Replace(currpath[len(gsrcpath)+1:], string(filepath.Separator), "/", -1)
+				return currpath, packpath, nil
+			}
+		}
+	}
+
+	// Outside of GOPATH the application is created in the current
+	// directory as (or inside) a Go module.
+	if GoModulesEnabled() {
+		if found, modRoot, modPath := SearchGoMod(filepath.Dir(currpath)); found {
+			rel, _ := filepath.Rel(modRoot, currpath)
+			packpath = modPath + "/" + filepath.ToSlash(rel)
+		} else {
+			packpath = filepath.ToSlash(appname)
 		}
+		return currpath, packpath, nil
 	}
 
 	// In case of multiple paths in the GOPATH, by default